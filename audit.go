@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+)
+
+type auditEntry struct {
+	Time      time.Time `json:"time"`
+	From      float64   `json:"from_seconds"`
+	To        float64   `json:"to_seconds"`
+	Trigger   string    `json:"trigger"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+type audit struct {
+	ch chan auditEntry
+}
+
+func newAudit(path string) (*audit, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	a := &audit{ch: make(chan auditEntry, 256)}
+	go a.run(f)
+	return a, nil
+}
+
+func (a *audit) run(f *os.File) {
+	enc := json.NewEncoder(f)
+	for e := range a.ch {
+		if err := enc.Encode(e); err != nil {
+			log.Printf("warn: delay audit: %v", err)
+		}
+	}
+}
+
+func (a *audit) record(from time.Duration, to time.Duration, trigger string, requestID string) {
+	if a == nil {
+		return
+	}
+	select {
+	case a.ch <- auditEntry{Time: time.Now().UTC(), From: from.Seconds(), To: to.Seconds(), Trigger: trigger, RequestID: requestID}:
+	default:
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/instrument/asyncfloat64"
+)
+
+const (
+	classRateLimit     = "rate_limit"
+	classEdgeRateLimit = "edge_rate_limit"
+	classUnavailable   = "unavailable"
+	classCapacity      = "capacity"
+	classNetwork       = "network"
+	classOther         = "other"
+)
+
+type strategy struct {
+	initial time.Duration
+	max     time.Duration
+	grow    func(time.Duration) time.Duration
+}
+
+type classBackoff struct {
+	strategy
+	delay        time.Duration
+	lastDelayInc time.Time
+}
+
+type backoff struct {
+	mu          sync.Mutex
+	now         func() time.Time
+	classes     map[string]*classBackoff
+	last        string
+	after       int
+	consecutive int
+	lastLimited time.Time
+}
+
+const warmupFloor = 5 * time.Second
+
+// scheduleRelax is how many responses in a row without a 429 halve the
+// schedule interval, down to warmupFloor.
+const scheduleRelax = 10
+
+type schedule struct {
+	mu       sync.Mutex
+	state    string
+	interval time.Duration
+	clean    int
+}
+
+type limiter struct {
+	backoff  *backoff
+	adaptive *schedule
+	base     time.Duration
+	mu       sync.Mutex
+	next     time.Time
+	retryAt  time.Time
+	warmup   int
+}
+
+var strategies = map[string]strategy{
+	classRateLimit:     {initial: 31 * time.Second, max: 10 * time.Minute, grow: func(d time.Duration) time.Duration { return d + d/2 }},
+	classUnavailable:   {initial: 31 * time.Second, max: 30 * time.Minute, grow: func(d time.Duration) time.Duration { return d * 2 }},
+	classEdgeRateLimit: {initial: 2 * time.Minute, max: 30 * time.Minute, grow: func(d time.Duration) time.Duration { return d * 2 }},
+	classCapacity:      {initial: 31 * time.Second},
+	classNetwork:       {initial: 5 * time.Second},
+	classOther:         {initial: 31 * time.Second},
+}
+
+func newBackoff(after int) *backoff {
+	b := &backoff{now: time.Now, classes: map[string]*classBackoff{}, last: classOther, after: after}
+	for class, s := range strategies {
+		b.classes[class] = &classBackoff{
+			strategy:     s,
+			delay:        s.initial,
+			lastDelayInc: b.now(),
+		}
+	}
+	return b
+}
+
+// since returns how long ago t was. If the clock stepped back past t, t is
+// moved to now so the wait restarts instead of stalling for the whole step.
+func (b *backoff) since(t *time.Time) time.Duration {
+	now := b.now()
+	if d := now.Sub(*t); d >= 0 {
+		return d
+	}
+	*t = now
+	return 0
+}
+
+func newSchedule() *schedule {
+	return &schedule{state: "probe", interval: warmupFloor}
+}
+
+func (s *schedule) observe(class string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.state
+	switch class {
+	case classRateLimit, classEdgeRateLimit:
+		state = "settle"
+		s.clean = 0
+		s.interval *= 2
+		if max := strategies[classRateLimit].max; s.interval > max {
+			s.interval = max
+		}
+	default:
+		if class == classCapacity {
+			state = "steady"
+		}
+		if s.clean++; s.clean >= scheduleRelax && s.interval > warmupFloor {
+			from := s.interval
+			s.clean = 0
+			if s.interval /= 2; s.interval < warmupFloor {
+				s.interval = warmupFloor
+			}
+			log.Printf("schedule interval changed from %v to %v", from, s.interval)
+		}
+	}
+	if state != s.state {
+		log.Printf("schedule changed from %s to %s at %v", s.state, state, s.interval)
+		s.state = state
+	}
+}
+
+func (s *schedule) current() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.interval
+}
+
+func newLimiter(b *backoff, perMinute float64, warmup int, adaptive bool) *limiter {
+	l := &limiter{backoff: b, warmup: warmup}
+	if adaptive {
+		l.adaptive = newSchedule()
+		l.warmup = 0
+	}
+	l.setRate(perMinute)
+	return l
+}
+
+func (b *backoff) current() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.classes[b.last].delay
+}
+
+// reset puts every class back to its initial delay and reports whether any
+// of them had grown.
+func (b *backoff) reset() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	changed := false
+	for _, cb := range b.classes {
+		changed = changed || cb.delay != cb.initial
+		cb.delay = cb.initial
+	}
+	b.consecutive = 0
+	b.last = classOther
+	return changed
+}
+
+func (b *backoff) lastClass() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.last
+}
+
+func (b *backoff) update(class string) (int, time.Duration, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.last = class
+	limited := class == classRateLimit || class == classEdgeRateLimit
+	if limited {
+		if b.since(&b.lastLimited) > 5*time.Minute {
+			b.consecutive = 0
+		}
+		b.consecutive++
+		b.lastLimited = b.now()
+	} else {
+		b.consecutive = 0
+	}
+	if class != classUnavailable {
+		b.classes[classUnavailable].delay = b.classes[classUnavailable].initial
+	}
+	if !limited {
+		b.classes[classEdgeRateLimit].delay = b.classes[classEdgeRateLimit].initial
+	}
+
+	if limited && b.consecutive < b.after {
+		return 0, 0, 0
+	}
+
+	cb := b.classes[class]
+	if cb.grow != nil {
+		from := cb.delay
+		cb.delay = cb.grow(cb.delay)
+		if cb.delay > cb.max {
+			cb.delay = cb.max
+		}
+		cb.lastDelayInc = b.now()
+		return 1, from, cb.delay
+	}
+
+	rl := b.classes[classRateLimit]
+	if rl.delay > rl.initial && b.since(&rl.lastDelayInc) > 5*time.Minute {
+		from := rl.delay
+		rl.delay = rl.initial + (rl.delay-rl.initial)/2
+		rl.lastDelayInc = b.now()
+		return -1, from, rl.delay
+	}
+	return 0, 0, 0
+}
+
+func (b *backoff) throttled() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	rl, edge := b.classes[classRateLimit], b.classes[classEdgeRateLimit]
+	return rl.delay - rl.initial + edge.delay - edge.initial
+}
+
+func (b *backoff) observe(ctx context.Context, gauge asyncfloat64.Gauge) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for class, cb := range b.classes {
+		gauge.Observe(ctx, cb.delay.Seconds(), attribute.Key("class").String(class))
+	}
+}
+
+func (l *limiter) setRate(perMinute float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.base = 0
+	if perMinute > 0 {
+		l.base = time.Duration(float64(time.Minute) / perMinute)
+	}
+}
+
+func (l *limiter) interval() time.Duration {
+	l.mu.Lock()
+	warm := l.warmup > 0
+	base := l.base
+	l.mu.Unlock()
+	if warm {
+		return warmupFloor
+	}
+	return l.intervalFor(base)
+}
+
+func (l *limiter) retryDelay() time.Duration {
+	d := l.interval()
+	l.mu.Lock()
+	l.retryAt = time.Now().Add(d)
+	l.mu.Unlock()
+	return d
+}
+
+func (l *limiter) observe(ctx context.Context, gauge asyncfloat64.Gauge) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	next := l.next
+	if l.retryAt.After(next) {
+		next = l.retryAt
+	}
+	if !next.IsZero() {
+		gauge.Observe(ctx, float64(next.UnixNano())/float64(time.Second))
+	}
+}
+
+// jittered returns d moved by a random amount of up to fraction of it in
+// either direction.
+func jittered(d time.Duration, fraction float64) time.Duration {
+	return d + time.Duration((rand.Float64()*2-1)*fraction*float64(d))
+}
+
+func (l *limiter) intervalFor(base time.Duration) time.Duration {
+	if l.adaptive != nil {
+		return jittered(l.adaptive.current(), 0.1)
+	}
+	if base == 0 {
+		return l.backoff.current()
+	}
+	return jittered(base, 0.1) + l.backoff.throttled()
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	if l.warmup > 0 {
+		l.warmup--
+		l.next = at.Add(warmupFloor)
+	} else {
+		l.next = at.Add(l.intervalFor(l.base))
+	}
+	l.mu.Unlock()
+
+	t := time.NewTimer(time.Until(at))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
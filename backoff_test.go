@@ -0,0 +1,134 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a wall clock without monotonic readings, so it can be stepped
+// backward the way NTP or a VM migration steps the real one.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time       { return c.t }
+func (c *fakeClock) step(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestBackoffDecayAcrossClockJump(t *testing.T) {
+	tests := []struct {
+		name  string
+		jump  time.Duration
+		steps []time.Duration
+		want  []int
+	}{
+		{"steady clock", 0, []time.Duration{4 * time.Minute, 2 * time.Minute}, []int{0, -1}},
+		{"backward jump", -time.Hour, []time.Duration{0, 4 * time.Minute, 2 * time.Minute}, []int{0, 0, -1}},
+		{"forward jump", time.Hour, []time.Duration{0}, []int{-1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+			b := newBackoff(1)
+			b.now = clock.now
+
+			if change, _, _ := b.update(classRateLimit); change != 1 {
+				t.Fatalf("rate limit change = %d, want 1", change)
+			}
+			clock.step(tt.jump)
+			for i, d := range tt.steps {
+				clock.step(d)
+				if change, _, _ := b.update(classCapacity); change != tt.want[i] {
+					t.Errorf("step %d: change = %d, want %d", i, change, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestScheduleTransitions(t *testing.T) {
+	tests := []struct {
+		name     string
+		classes  []string
+		state    string
+		interval time.Duration
+	}{
+		{"starts probing", nil, "probe", warmupFloor},
+		{"probe stays on other errors", []string{classOther, classNetwork, classUnavailable}, "probe", warmupFloor},
+		{"probe to settle on 429", []string{classRateLimit}, "settle", 2 * warmupFloor},
+		{"probe to settle on edge 429", []string{classEdgeRateLimit}, "settle", 2 * warmupFloor},
+		{"probe to steady on capacity", []string{classCapacity}, "steady", warmupFloor},
+		{"settle keeps widening", []string{classRateLimit, classRateLimit, classRateLimit}, "settle", 8 * warmupFloor},
+		{"settle to steady holds interval", []string{classRateLimit, classCapacity}, "steady", 2 * warmupFloor},
+		{"steady to settle on 429", []string{classCapacity, classRateLimit}, "settle", 2 * warmupFloor},
+		{"settle capped", []string{classRateLimit, classRateLimit, classRateLimit, classRateLimit, classRateLimit, classRateLimit, classRateLimit, classRateLimit}, "settle", strategies[classRateLimit].max},
+		{"steady steps down", repeat(classRateLimit, 3, classCapacity, scheduleRelax), "steady", 4 * warmupFloor},
+		{"steady back to the floor", repeat(classRateLimit, 3, classCapacity, 4*scheduleRelax), "steady", warmupFloor},
+		{"other errors step down", repeat(classRateLimit, 1, classOther, scheduleRelax), "settle", warmupFloor},
+		{"429 restarts the clean run", append(repeat(classRateLimit, 1, classCapacity, scheduleRelax-1), repeat(classRateLimit, 1, classCapacity, scheduleRelax-1)...), "steady", 4 * warmupFloor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSchedule()
+			for _, class := range tt.classes {
+				s.observe(class)
+			}
+			if s.state != tt.state || s.current() != tt.interval {
+				t.Errorf("schedule = %s at %v, want %s at %v", s.state, s.current(), tt.state, tt.interval)
+			}
+		})
+	}
+}
+
+func TestBackoffResetOnSuccess(t *testing.T) {
+	tests := []struct {
+		name    string
+		after   int
+		before  []string
+		changed bool
+		resume  []string
+		want    time.Duration
+	}{
+		{"grown rate limit", 1, []string{classRateLimit, classRateLimit, classRateLimit}, true, []string{classRateLimit}, 46500 * time.Millisecond},
+		{"grown unavailable", 1, []string{classUnavailable, classUnavailable}, true, []string{classUnavailable}, 62 * time.Second},
+		{"nothing grown", 1, []string{classCapacity}, false, []string{classCapacity}, 31 * time.Second},
+		{"consecutive count restarts", 2, []string{classRateLimit, classRateLimit, classRateLimit}, true, []string{classRateLimit}, 31 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBackoff(tt.after)
+			for _, class := range tt.before {
+				b.update(class)
+			}
+			if got := b.reset(); got != tt.changed {
+				t.Errorf("reset = %v, want %v", got, tt.changed)
+			}
+			for class, cb := range b.classes {
+				if cb.delay != cb.initial {
+					t.Errorf("%s delay after reset = %v, want %v", class, cb.delay, cb.initial)
+				}
+			}
+			if b.lastClass() != classOther || b.reset() {
+				t.Errorf("second reset reported a change or last class is %s", b.lastClass())
+			}
+			for _, class := range tt.resume {
+				b.update(class)
+			}
+			if got := b.current(); got != tt.want {
+				t.Errorf("delay after resume = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// repeat returns class a n times followed by class b m times.
+func repeat(a string, n int, b string, m int) []string {
+	var classes []string
+	for i := 0; i < n+m; i++ {
+		if i < n {
+			classes = append(classes, a)
+		} else {
+			classes = append(classes, b)
+		}
+	}
+	return classes
+}
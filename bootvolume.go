@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+func prepareBootVolume(ctx context.Context, c core.BlockstorageClient) error {
+	resp, err := c.GetBootVolume(ctx, core.GetBootVolumeRequest{BootVolumeId: common.String(conf.instanceBootVolumeID)})
+	if err != nil {
+		return err
+	}
+	ad := stringValue(resp.AvailabilityDomain)
+	found := len(conf.instanceADs) == 0
+	for _, a := range conf.instanceADs {
+		found = found || a == ad
+	}
+	if !found {
+		return fmt.Errorf("boot volume %s is in %s, which is not in INSTANCE_AD", conf.instanceBootVolumeID, ad)
+	}
+	if conf.bootVolumeSize == 0 || resp.SizeInGBs == nil {
+		return nil
+	}
+
+	size := *resp.SizeInGBs
+	switch {
+	case int64(conf.bootVolumeSize) < size:
+		return fmt.Errorf("BOOT_VOLUME_SIZE_GB %d is smaller than boot volume %s (%d GB), volumes cannot shrink", conf.bootVolumeSize, conf.instanceBootVolumeID, size)
+	case int64(conf.bootVolumeSize) == size:
+		return nil
+	}
+	_, err = c.UpdateBootVolume(ctx, core.UpdateBootVolumeRequest{
+		BootVolumeId:            common.String(conf.instanceBootVolumeID),
+		UpdateBootVolumeDetails: core.UpdateBootVolumeDetails{SizeInGBs: optionalInt64(conf.bootVolumeSize)},
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("%s: resized from %d to %d GB", conf.instanceBootVolumeID, size, conf.bootVolumeSize)
+	return nil
+}
+
+func sourceDetails(shape string) core.InstanceSourceDetails {
+	if conf.instanceBootVolumeID != "" {
+		return core.InstanceSourceViaBootVolumeDetails{
+			BootVolumeId: common.String(conf.instanceBootVolumeID),
+		}
+	}
+	return core.InstanceSourceViaImageDetails{
+		ImageId:             common.String(imageFor(shape)),
+		BootVolumeSizeInGBs: optionalInt64(conf.bootVolumeSize),
+		KmsKeyId:            optionalString(conf.bootVolumeKmsKeyID),
+		BootVolumeVpusPerGB: optionalInt64(conf.bootVolumeVpus),
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+type budgetState struct {
+	Day        string `json:"day"`
+	DayCount   int    `json:"day_count"`
+	Month      string `json:"month"`
+	MonthCount int    `json:"month_count"`
+}
+
+type budget struct {
+	mu       sync.Mutex
+	path     string
+	perDay   int
+	perMonth int
+	state    budgetState
+}
+
+func newBudget(perDay, perMonth int, path string) (*budget, error) {
+	if perDay == 0 && perMonth == 0 {
+		return nil, nil
+	}
+	b := &budget{path: path, perDay: perDay, perMonth: perMonth}
+	if path == "" {
+		return b, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &b.state); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// take counts one request, blocking until the day or month rolls over once
+// its budget is spent.
+func (b *budget) take(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	for {
+		b.mu.Lock()
+		now := time.Now().UTC()
+		if day := now.Format("2006-01-02"); b.state.Day != day {
+			b.state.Day, b.state.DayCount = day, 0
+		}
+		if month := now.Format("2006-01"); b.state.Month != month {
+			b.state.Month, b.state.MonthCount = month, 0
+		}
+
+		var until time.Time
+		switch {
+		case b.perMonth > 0 && b.state.MonthCount >= b.perMonth:
+			until = time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case b.perDay > 0 && b.state.DayCount >= b.perDay:
+			until = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		}
+		if until.IsZero() {
+			b.state.DayCount++
+			b.state.MonthCount++
+			b.save()
+			b.mu.Unlock()
+			return nil
+		}
+		day, month := b.state.DayCount, b.state.MonthCount
+		b.mu.Unlock()
+
+		log.Printf("request budget spent (%d today, %d this month), pausing until %s", day, month, until.Format(time.RFC3339))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Until(until)):
+		}
+	}
+}
+
+func (b *budget) save() {
+	if b.path == "" {
+		return
+	}
+	data, err := json.Marshal(b.state)
+	if err == nil {
+		err = writeFileAtomic(b.path, data)
+	}
+	if err != nil {
+		log.Printf("warn: saving request budget: %v", err)
+	}
+}
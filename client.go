@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/identity"
+
+	"golang.org/x/time/rate"
+)
+
+type rateLimitedDispatcher struct {
+	limiter    *rate.Limiter
+	budget     *budget
+	dispatcher common.HTTPRequestDispatcher
+}
+
+func newAPILimiter(perMinute int) *rate.Limiter {
+	if perMinute == 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Every(time.Minute/time.Duration(perMinute)), 1)
+}
+
+func (d rateLimitedDispatcher) Do(req *http.Request) (*http.Response, error) {
+	if err := d.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	if err := d.budget.take(req.Context()); err != nil {
+		return nil, err
+	}
+	return d.dispatcher.Do(req)
+}
+
+func newIdentityClient(cfg common.ConfigurationProvider) identity.IdentityClient {
+	c, err := identity.NewIdentityClientWithConfigurationProvider(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	configureClient(&c.BaseClient)
+	return c
+}
+
+func configureClient(client *common.BaseClient) {
+	if hc, ok := client.HTTPClient.(*http.Client); ok && conf.proxyURL != nil {
+		tr, ok := hc.Transport.(*http.Transport)
+		if !ok || tr == nil {
+			tr = http.DefaultTransport.(*http.Transport)
+		}
+		tr = tr.Clone()
+		tr.Proxy = http.ProxyURL(conf.proxyURL)
+		hc.Transport = tr
+	}
+	client.HTTPClient = rateLimitedDispatcher{limiter: conf.apiLimiter, budget: conf.budget, dispatcher: client.HTTPClient}
+	if len(conf.extraHeaders) > 0 {
+		client.Interceptor = chainInterceptors(client.Interceptor, headersInterceptor(conf.extraHeaders))
+	}
+	if conf.userAgentSuffix != "" {
+		client.UserAgent += " " + conf.userAgentSuffix
+	}
+}
+
+var headerName = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// reservedHeaders are part of the request signature or set by the SDK.
+var reservedHeaders = map[string]bool{
+	"Authorization":    true,
+	"Date":             true,
+	"Host":             true,
+	"Content-Length":   true,
+	"Content-Type":     true,
+	"X-Content-Sha256": true,
+	"User-Agent":       true,
+}
+
+func parseHeaders(s string) (http.Header, error) {
+	h := http.Header{}
+	for _, entry := range parseList(s) {
+		k, v, ok := strings.Cut(entry, "=")
+		k = strings.TrimSpace(k)
+		if !ok || !headerName.MatchString(k) {
+			return nil, fmt.Errorf("invalid OCI_EXTRA_HEADERS entry: %q", entry)
+		}
+		if reservedHeaders[http.CanonicalHeaderKey(k)] {
+			return nil, fmt.Errorf("OCI_EXTRA_HEADERS cannot set %s", http.CanonicalHeaderKey(k))
+		}
+		h.Add(k, strings.TrimSpace(v))
+	}
+	return h, nil
+}
+
+func chainInterceptors(interceptors ...common.RequestInterceptor) common.RequestInterceptor {
+	return func(req *http.Request) error {
+		for _, i := range interceptors {
+			if i == nil {
+				continue
+			}
+			if err := i(req); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func headersInterceptor(h http.Header) common.RequestInterceptor {
+	return func(req *http.Request) error {
+		for k, vs := range h {
+			req.Header[k] = vs
+		}
+		return nil
+	}
+}
+
+func computeClusterInterceptor(id string) common.RequestInterceptor {
+	return func(req *http.Request) error {
+		if req.Method != http.MethodPost || !strings.HasSuffix(req.URL.Path, "/instances") || req.Body == nil {
+			return nil
+		}
+		b, err := io.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		body := map[string]interface{}{}
+		if err := json.Unmarshal(b, &body); err != nil {
+			return err
+		}
+		body["computeClusterId"] = id
+		if b, err = json.Marshal(body); err != nil {
+			return err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(b))
+		req.ContentLength = int64(len(b))
+		req.Header.Set("Content-Length", strconv.Itoa(len(b)))
+		return nil
+	}
+}
@@ -0,0 +1,743 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v65/core"
+
+	"mol.net.br/goci/pkg/hunter"
+
+	"go.opentelemetry.io/otel/metric/instrument/asyncfloat64"
+	"go.opentelemetry.io/otel/metric/instrument/syncfloat64"
+
+	"golang.org/x/time/rate"
+)
+
+type config struct {
+	instanceShapes              []string
+	instanceName                string
+	skipIfExists                bool
+	instanceImage               string
+	instanceImageOS             string
+	instanceImageOSVersion      string
+	instanceBootVolumeID        string
+	images                      map[string]string
+	instanceSubnet              string
+	instanceADs                 []string
+	instanceCompartments        []string
+	compartments                *rotation
+	instanceSshAuthorized       string
+	vnicDisplayName             string
+	vnicHostname                string
+	validateSubnetDNS           bool
+	secondaryVnics              []secondaryVnic
+	user                        string
+	authMethod                  string
+	ociConfigFile               string
+	ociProfile                  string
+	fingerprint                 string
+	privateKey                  string
+	tenancy                     string
+	region                      string
+	realm                       string
+	counter                     syncfloat64.Counter
+	sdkRetries                  syncfloat64.Counter
+	consistencyRetries          syncfloat64.Counter
+	gauge                       asyncfloat64.Gauge
+	delayIncrements             syncfloat64.Counter
+	delayDecrements             syncfloat64.Counter
+	rateLimits                  *rateLimits
+	messageRegex                *regexp.Regexp
+	warnOnCodes                 map[string]bool
+	features                    map[string]bool
+	errorsMax                   int
+	concurrency                 int
+	targetRate                  float64
+	warmupAttempts              int
+	backoffAfter                int
+	backoffResetOnSuccess       bool
+	eventualConsistency         bool
+	adaptiveSchedule            bool
+	delayAuditFile              string
+	audit                       *audit
+	launchOptions               *core.LaunchOptions
+	launchDetails               *core.LaunchInstanceDetails
+	apiRateLimit                int
+	maxRequestsPerDay           int
+	maxRequestsPerMonth         int
+	budgetFile                  string
+	budget                      *budget
+	apiLimiter                  *rate.Limiter
+	instanceNvmes               int
+	ocpusMin                    float64
+	ocpusMax                    float64
+	memoryMin                   float64
+	memoryMax                   float64
+	sizes                       *sizes
+	validateShape               bool
+	checkLimits                 bool
+	checkLimitsFatal            bool
+	instancePrivateIP           string
+	instanceSubnetCIDR          string
+	skipSourceDestCheck         bool
+	autoDefaultTags             bool
+	definedTags                 map[string]map[string]map[string]interface{}
+	bootVolumeKmsKeyID          string
+	bootVolumeVpus              int
+	bootVolumeSize              int
+	pvEncryption                bool
+	liveMigrationPreferred      *bool
+	secureBoot                  bool
+	measuredBoot                bool
+	tpmEnabled                  bool
+	computeClusterID            string
+	captureConsole              bool
+	consoleHistoryFile          string
+	outputFile                  string
+	provisionTimeout            time.Duration
+	provisionPollInterval       time.Duration
+	provisionPollJitter         float64
+	terminateOnProvisionFailure bool
+	preserveBootVolume          bool
+	mode                        string
+	discover                    bool
+	printRequest                bool
+	plan                        bool
+	confirm                     bool
+	instanceID                  string
+	instanceConfigurationID     string
+	userAgentSuffix             string
+	proxyURL                    *url.URL
+	extraHeaders                http.Header
+	exitOnSuccess               bool
+	coordinationFile            string
+	coordinationURL             string
+	coordinator                 coordinator
+	workers                     *workers
+	runDeadline                 time.Duration
+	notifyWebhookURLs           []string
+	notifyOnError               bool
+	notifyMinInterval           time.Duration
+	telegramBotToken            string
+	telegramChatID              string
+	onsTopicID                  string
+	notifier                    *notifier
+	minSuccessCount             int
+	terminateExtraInstances     bool
+	maxAttempts                 int
+	metricsRequired             bool
+	metricsExporter             string
+	metricsStrict               bool
+	statsdAddr                  string
+	metricsTextfile             string
+	metricsTextfileInterval     time.Duration
+	metricsTLSCert              string
+	metricsTLSKey               string
+	metricsAuthToken            string
+	metricsBasicAuth            string
+	metricsReadHeaderTimeout    time.Duration
+	metricsReadTimeout          time.Duration
+	metricsWriteTimeout         time.Duration
+	metricsIdleTimeout          time.Duration
+	healthWindow                time.Duration
+	heartbeatInterval           time.Duration
+	health                      *health
+	backoff                     *backoff
+	limiter                     *limiter
+	targets                     *targetSet
+	pause                       *pause
+	errors                      *errorLog
+	hunter                      *hunter.Hunter
+}
+
+type env struct {
+	errs []string
+}
+
+func (e *env) failf(format string, args ...interface{}) {
+	e.errs = append(e.errs, fmt.Sprintf(format, args...))
+}
+
+func (e *env) err() error {
+	if len(e.errs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(e.errs, "; "))
+}
+
+func (e *env) str(name string) string {
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			e.failf("reading %s_FILE: %v", name, err)
+			return ""
+		}
+		return strings.TrimSpace(string(b))
+	}
+	return os.Getenv(name)
+}
+
+func (e *env) strOr(name string, def string) string {
+	if v := e.str(name); v != "" {
+		return v
+	}
+	return def
+}
+
+func (e *env) list(name string) []string {
+	return parseList(e.str(name))
+}
+
+func (e *env) set(name string) map[string]bool {
+	return parseSet(e.str(name))
+}
+
+func (e *env) int(name string, def int) int {
+	v := e.str(name)
+	if v == "" {
+		return def
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 {
+		e.failf("invalid %s: %q", name, v)
+		return def
+	}
+	return i
+}
+
+func (e *env) bool(name string, def bool) bool {
+	v := e.str(name)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.failf("invalid %s: %q", name, v)
+		return def
+	}
+	return b
+}
+
+func (e *env) float(name string, def float64) float64 {
+	v := e.str(name)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f <= 0 {
+		e.failf("invalid %s: %q", name, v)
+		return def
+	}
+	return f
+}
+
+// fraction is float for values where 0 is meaningful; callers check the
+// range.
+func (e *env) fraction(name string, def float64) float64 {
+	v := e.str(name)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		e.failf("invalid %s: %q", name, v)
+		return def
+	}
+	return f
+}
+
+func (e *env) duration(name string, def time.Duration) time.Duration {
+	v := e.str(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		e.failf("invalid %s: %q", name, v)
+		return def
+	}
+	return d
+}
+
+func parseList(s string) []string {
+	list := []string{}
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func parseSet(s string) map[string]bool {
+	set := map[string]bool{}
+	for _, v := range parseList(s) {
+		set[v] = true
+	}
+	return set
+}
+
+func parsePrivateIP(ip string, cidr string) (string, error) {
+	if ip == "" {
+		return "", nil
+	}
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return "", fmt.Errorf("invalid INSTANCE_PRIVATE_IP: %q", ip)
+	}
+
+	if cidr == "" {
+		return ip, nil
+	}
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", fmt.Errorf("invalid INSTANCE_SUBNET_CIDR: %q", cidr)
+	}
+	if !network.Contains(addr) {
+		return "", fmt.Errorf("INSTANCE_PRIVATE_IP %s is outside of %s", ip, cidr)
+	}
+	return ip, nil
+}
+
+func parseLaunchDetails(s string) (*core.LaunchInstanceDetails, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var d core.LaunchInstanceDetails
+	if err := json.Unmarshal([]byte(s), &d); err != nil {
+		return nil, fmt.Errorf("invalid LAUNCH_DETAILS_JSON: %w", err)
+	}
+	var missing []string
+	if d.CompartmentId == nil {
+		missing = append(missing, "compartmentId")
+	}
+	if d.AvailabilityDomain == nil {
+		missing = append(missing, "availabilityDomain")
+	}
+	if d.Shape == nil {
+		missing = append(missing, "shape")
+	}
+	if d.SourceDetails == nil && d.ImageId == nil {
+		missing = append(missing, "sourceDetails")
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("LAUNCH_DETAILS_JSON is missing %s", strings.Join(missing, ", "))
+	}
+	return &d, nil
+}
+
+func parseLaunchOptions(mode string, firmware string) (*core.LaunchOptions, error) {
+	if mode == "" && firmware == "" {
+		return nil, nil
+	}
+
+	opts := &core.LaunchOptions{}
+	if mode != "" {
+		m, ok := core.GetMappingInstanceLaunchModeEnum(mode)
+		if !ok {
+			return nil, fmt.Errorf("invalid LAUNCH_MODE: %q", mode)
+		}
+		switch m {
+		case core.InstanceLaunchModeNative:
+			opts.BootVolumeType = core.LaunchOptionsBootVolumeTypeIscsi
+			opts.NetworkType = core.LaunchOptionsNetworkTypeVfio
+			opts.RemoteDataVolumeType = core.LaunchOptionsRemoteDataVolumeTypeIscsi
+		case core.InstanceLaunchModeEmulated:
+			opts.BootVolumeType = core.LaunchOptionsBootVolumeTypeScsi
+			opts.NetworkType = core.LaunchOptionsNetworkTypeE1000
+			opts.RemoteDataVolumeType = core.LaunchOptionsRemoteDataVolumeTypeScsi
+		case core.InstanceLaunchModeParavirtualized:
+			opts.BootVolumeType = core.LaunchOptionsBootVolumeTypeParavirtualized
+			opts.NetworkType = core.LaunchOptionsNetworkTypeParavirtualized
+			opts.RemoteDataVolumeType = core.LaunchOptionsRemoteDataVolumeTypeParavirtualized
+		default:
+			return nil, fmt.Errorf("unsupported LAUNCH_MODE: %q", mode)
+		}
+	}
+
+	if firmware != "" {
+		f, ok := core.GetMappingLaunchOptionsFirmwareEnum(firmware)
+		if !ok {
+			return nil, fmt.Errorf("invalid LAUNCH_FIRMWARE: %q", firmware)
+		}
+		opts.Firmware = f
+	}
+
+	return opts, nil
+}
+
+func parsePrivateKey(key string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(key))
+	if block == nil {
+		return nil, errors.New("private key is not valid PEM")
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("expected RSA private key: %v", err)
+	}
+	rk, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("expected RSA private key, got %T", k)
+	}
+	return rk, nil
+}
+
+func keyFingerprint(key *rsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	sum := md5.Sum(der)
+	hex := make([]string, len(sum))
+	for i, b := range sum {
+		hex[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(hex, ":"), nil
+}
+
+var knownFeatures = map[string]bool{
+	"adaptive-schedule": true,
+}
+
+func (c config) buildsLaunchDetails() bool {
+	return c.mode == "launch" || c.mode == "oneshot" || c.mode == "doctor"
+}
+
+func loadConfig() (config, error) {
+	e := &env{}
+
+	c := config{
+		instanceShapes:              e.list("INSTANCE_SHAPE"),
+		instanceName:                e.str("INSTANCE_NAME"),
+		skipIfExists:                e.bool("SKIP_IF_EXISTS", false),
+		instanceImage:               e.str("INSTANCE_IMAGE"),
+		instanceImageOS:             e.str("INSTANCE_IMAGE_OS"),
+		instanceImageOSVersion:      e.str("INSTANCE_IMAGE_OS_VERSION"),
+		instanceBootVolumeID:        e.str("INSTANCE_BOOT_VOLUME_ID"),
+		instanceSubnet:              e.str("INSTANCE_SUBNET"),
+		instanceADs:                 e.list("INSTANCE_AD"),
+		instanceCompartments:        e.list("INSTANCE_COMPARTMENT"),
+		instanceSshAuthorized:       e.str("INSTANCE_SSHAUTHORIZED"),
+		vnicDisplayName:             e.str("VNIC_DISPLAY_NAME"),
+		vnicHostname:                e.str("VNIC_HOSTNAME"),
+		validateSubnetDNS:           e.bool("VALIDATE_SUBNET_DNS", false),
+		user:                        e.str("USER"),
+		authMethod:                  e.strOr("AUTH_METHOD", "raw"),
+		ociConfigFile:               e.strOr("OCI_CONFIG_FILE", "~/.oci/config"),
+		ociProfile:                  e.strOr("OCI_PROFILE", "DEFAULT"),
+		fingerprint:                 e.str("FINGERPRINT"),
+		privateKey:                  strings.Replace(e.str("PRIVATE_KEY"), "\\n", "\n", -1),
+		tenancy:                     e.str("TENANCY"),
+		messageRegex:                regexp.MustCompile(`Message: (.+)\.?`),
+		warnOnCodes:                 e.set("WARN_ON_CODES"),
+		features:                    e.set("FEATURES"),
+		errorsMax:                   e.int("ERRORS_MAX", 50),
+		concurrency:                 e.int("CONCURRENCY", 1),
+		targetRate:                  e.float("TARGET_RATE_PER_MINUTE", 0),
+		warmupAttempts:              e.int("WARMUP_ATTEMPTS", 0),
+		backoffAfter:                e.int("BACKOFF_AFTER_N_429", 1),
+		backoffResetOnSuccess:       e.bool("BACKOFF_RESET_ON_SUCCESS", true),
+		eventualConsistency:         e.bool("EVENTUAL_CONSISTENCY", false),
+		adaptiveSchedule:            e.bool("ADAPTIVE_SCHEDULE", false),
+		delayAuditFile:              e.str("DELAY_AUDIT_FILE"),
+		apiRateLimit:                e.int("API_RATE_LIMIT", 0),
+		maxRequestsPerDay:           e.int("MAX_REQUESTS_PER_DAY", 0),
+		maxRequestsPerMonth:         e.int("MAX_REQUESTS_PER_MONTH", 0),
+		budgetFile:                  e.str("REQUEST_BUDGET_FILE"),
+		instanceNvmes:               e.int("INSTANCE_NVMES", 0),
+		ocpusMin:                    e.float("INSTANCE_OCPUS_MIN", 0),
+		ocpusMax:                    e.float("INSTANCE_OCPUS_MAX", 4),
+		memoryMin:                   e.float("INSTANCE_MEMORY_MIN", 0),
+		memoryMax:                   e.float("INSTANCE_MEMORY_MAX", 24),
+		validateShape:               e.bool("VALIDATE_SHAPE", false),
+		checkLimits:                 e.bool("CHECK_LIMITS", false),
+		checkLimitsFatal:            e.bool("CHECK_LIMITS_FATAL", false),
+		instanceSubnetCIDR:          e.str("INSTANCE_SUBNET_CIDR"),
+		skipSourceDestCheck:         e.bool("SKIP_SOURCE_DEST_CHECK", false),
+		autoDefaultTags:             e.bool("AUTO_DEFAULT_TAGS", false),
+		bootVolumeKmsKeyID:          e.str("BOOT_VOLUME_KMS_KEY_ID"),
+		bootVolumeVpus:              e.int("BOOT_VOLUME_VPUS", 0),
+		bootVolumeSize:              e.int("BOOT_VOLUME_SIZE_GB", 0),
+		pvEncryption:                e.bool("ENABLE_PV_ENCRYPTION", false),
+		secureBoot:                  e.bool("SECURE_BOOT", false),
+		measuredBoot:                e.bool("MEASURED_BOOT", false),
+		tpmEnabled:                  e.bool("TPM_ENABLED", false),
+		computeClusterID:            e.str("COMPUTE_CLUSTER_ID"),
+		captureConsole:              e.bool("CAPTURE_CONSOLE_ON_FAILURE", false),
+		consoleHistoryFile:          e.str("CONSOLE_HISTORY_FILE"),
+		outputFile:                  e.str("OUTPUT_FILE"),
+		provisionTimeout:            e.duration("PROVISION_TIMEOUT", 30*time.Minute),
+		provisionPollInterval:       e.duration("PROVISION_POLL_INTERVAL", 10*time.Second),
+		provisionPollJitter:         e.fraction("PROVISION_POLL_JITTER", 0.2),
+		terminateOnProvisionFailure: e.bool("TERMINATE_ON_PROVISION_FAILURE", false),
+		preserveBootVolume:          e.bool("PRESERVE_BOOT_VOLUME_ON_TERMINATE", true),
+		mode:                        e.strOr("MODE", "launch"),
+		discover:                    e.bool("DISCOVER", false),
+		printRequest:                e.bool("PRINT_REQUEST", false),
+		plan:                        e.bool("PLAN", false),
+		confirm:                     e.bool("CONFIRM", false),
+		instanceID:                  e.str("INSTANCE_ID"),
+		instanceConfigurationID:     e.str("INSTANCE_CONFIGURATION_ID"),
+		userAgentSuffix:             e.strOr("USER_AGENT_SUFFIX", "goci/"+version),
+		exitOnSuccess:               e.bool("EXIT_ON_SUCCESS", true),
+		coordinationFile:            e.str("COORDINATION_FILE"),
+		coordinationURL:             e.str("COORDINATION_URL"),
+		runDeadline:                 e.duration("RUN_DEADLINE", 0),
+		notifyWebhookURLs:           e.list("NOTIFY_WEBHOOK_URL"),
+		notifyOnError:               e.bool("NOTIFY_ON_ERROR", false),
+		notifyMinInterval:           e.duration("NOTIFY_MIN_INTERVAL", time.Hour),
+		telegramBotToken:            e.str("TELEGRAM_BOT_TOKEN"),
+		telegramChatID:              e.str("TELEGRAM_CHAT_ID"),
+		onsTopicID:                  e.str("ONS_TOPIC_ID"),
+		minSuccessCount:             e.int("MIN_SUCCESS_COUNT", 1),
+		terminateExtraInstances:     e.bool("TERMINATE_EXTRA_INSTANCES", false),
+		maxAttempts:                 e.int("MAX_ATTEMPTS", 0),
+		metricsRequired:             e.bool("METRICS_REQUIRED", false),
+		metricsExporter:             e.strOr("METRICS_EXPORTER", "prometheus"),
+		metricsStrict:               e.bool("METRICS_STRICT", false),
+		statsdAddr:                  e.strOr("STATSD_ADDR", "127.0.0.1:8125"),
+		metricsTextfile:             e.str("METRICS_TEXTFILE"),
+		metricsTextfileInterval:     e.duration("METRICS_TEXTFILE_INTERVAL", 15*time.Second),
+		metricsTLSCert:              e.str("METRICS_TLS_CERT"),
+		metricsTLSKey:               e.str("METRICS_TLS_KEY"),
+		metricsAuthToken:            e.str("METRICS_AUTH_TOKEN"),
+		metricsBasicAuth:            e.str("METRICS_BASIC_AUTH"),
+		metricsReadHeaderTimeout:    e.duration("METRICS_READ_HEADER_TIMEOUT", 5*time.Second),
+		metricsReadTimeout:          e.duration("METRICS_READ_TIMEOUT", 10*time.Second),
+		metricsWriteTimeout:         e.duration("METRICS_WRITE_TIMEOUT", 30*time.Second),
+		metricsIdleTimeout:          e.duration("METRICS_IDLE_TIMEOUT", 2*time.Minute),
+		healthWindow:                e.duration("HEALTH_WINDOW", time.Hour),
+		heartbeatInterval:           e.duration("HEARTBEAT_INTERVAL", 0),
+	}
+
+	if _, ok := credentialProviders[c.authMethod]; !ok {
+		e.failf("invalid AUTH_METHOD: %q", c.authMethod)
+	}
+	if c.authMethod == "raw" {
+		if key, err := parsePrivateKey(c.privateKey); err != nil {
+			e.failf("PRIVATE_KEY: %v", err)
+		} else if fp, err := keyFingerprint(key); err != nil {
+			e.failf("FINGERPRINT cannot be derived: %v", err)
+		} else if c.fingerprint == "" {
+			c.fingerprint = fp
+		} else if c.fingerprint != fp {
+			log.Printf("warn: FINGERPRINT %s does not match PRIVATE_KEY (%s)", c.fingerprint, fp)
+		}
+	}
+
+	// Other methods carry a region of their own, which credentials uses
+	// when REGION is unset.
+	if s := e.str("REGION"); s != "" || c.authMethod == "raw" {
+		region, realm, err := normalizeRegion(s)
+		if err != nil {
+			e.failf("%v", err)
+		}
+		c.region, c.realm = string(region), realm
+	}
+
+	var err error
+	c.launchOptions, err = parseLaunchOptions(e.str("LAUNCH_MODE"), e.str("LAUNCH_FIRMWARE"))
+	if err != nil {
+		e.failf("%v", err)
+	}
+
+	if e.str("LIVE_MIGRATION_PREFERRED") != "" {
+		b := e.bool("LIVE_MIGRATION_PREFERRED", true)
+		c.liveMigrationPreferred = &b
+	}
+
+	if v := e.str("OCI_PROXY_URL"); v != "" {
+		u, err := url.Parse(v)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			e.failf("invalid OCI_PROXY_URL")
+		}
+		c.proxyURL = u
+	}
+
+	c.extraHeaders, err = parseHeaders(e.str("OCI_EXTRA_HEADERS"))
+	if err != nil {
+		e.failf("%v", err)
+	}
+
+	c.secondaryVnics, err = parseSecondaryVnics(e.str("SECONDARY_VNIC_SUBNETS"))
+	if err != nil {
+		e.failf("%v", err)
+	}
+
+	c.instancePrivateIP, err = parsePrivateIP(e.str("INSTANCE_PRIVATE_IP"), c.instanceSubnetCIDR)
+	if err != nil {
+		e.failf("%v", err)
+	}
+
+	for _, comp := range c.instanceCompartments {
+		if !isOCID(comp, "compartment", "tenancy") {
+			e.failf("invalid INSTANCE_COMPARTMENT: %q", comp)
+		}
+	}
+
+	if c.bootVolumeKmsKeyID != "" && !isOCID(c.bootVolumeKmsKeyID, "key") {
+		e.failf("invalid BOOT_VOLUME_KMS_KEY_ID: %q", c.bootVolumeKmsKeyID)
+	}
+
+	if c.bootVolumeVpus != 0 && (c.bootVolumeVpus < 10 || c.bootVolumeVpus > 120 || c.bootVolumeVpus%10 != 0) {
+		e.failf("BOOT_VOLUME_VPUS must be a multiple of 10 between 10 and 120")
+	}
+
+	if c.computeClusterID != "" && !isOCID(c.computeClusterID, "computecluster") {
+		e.failf("invalid COMPUTE_CLUSTER_ID: %q", c.computeClusterID)
+	}
+
+	if c.instanceImage != "" && c.instanceImageOS != "" {
+		e.failf("INSTANCE_IMAGE and INSTANCE_IMAGE_OS are mutually exclusive")
+	}
+	if c.instanceBootVolumeID != "" {
+		if c.instanceImage != "" || c.instanceImageOS != "" {
+			e.failf("INSTANCE_BOOT_VOLUME_ID is mutually exclusive with INSTANCE_IMAGE and INSTANCE_IMAGE_OS")
+		}
+		if !isOCID(c.instanceBootVolumeID, "bootvolume") {
+			e.failf("invalid INSTANCE_BOOT_VOLUME_ID: %q", c.instanceBootVolumeID)
+		}
+	}
+	if c.bootVolumeSize != 0 && (c.bootVolumeSize < 50 || c.bootVolumeSize > 32768) {
+		e.failf("BOOT_VOLUME_SIZE_GB must be between 50 and 32768")
+	}
+	if k, ok := imageKeywords[c.instanceImage]; ok {
+		c.instanceImageOS, c.instanceImageOSVersion, c.instanceImage = k[0], k[1], ""
+	}
+
+	if c.buildsLaunchDetails() {
+		for _, shape := range c.instanceShapes {
+			if _, err := platformConfig(c, shape); err != nil {
+				e.failf("%v", err)
+			}
+		}
+	}
+
+	switch c.mode {
+	case "launch", "oneshot", "doctor":
+	case "update":
+		if c.instanceID == "" {
+			e.failf("INSTANCE_ID is required in update mode")
+		}
+	case "pool":
+		if !isOCID(c.instanceConfigurationID, "instanceconfiguration") {
+			e.failf("invalid INSTANCE_CONFIGURATION_ID: %q", c.instanceConfigurationID)
+		}
+	default:
+		e.failf("invalid MODE: %q", c.mode)
+	}
+
+	if c.launchDetails, err = parseLaunchDetails(e.str("LAUNCH_DETAILS_JSON")); err != nil {
+		e.failf("%v", err)
+	} else if c.launchDetails != nil {
+		if len(c.instanceADs) == 0 {
+			c.instanceADs = []string{*c.launchDetails.AvailabilityDomain}
+		}
+		if len(c.instanceShapes) == 0 {
+			c.instanceShapes = []string{*c.launchDetails.Shape}
+		}
+		if len(c.instanceCompartments) == 0 {
+			c.instanceCompartments = []string{*c.launchDetails.CompartmentId}
+		}
+	}
+
+	if !c.discover && len(buildTargets(c)) == 0 {
+		e.failf("INSTANCE_AD and INSTANCE_SHAPE are required")
+	}
+
+	if c.ocpusMin == 0 {
+		c.ocpusMin = c.ocpusMax
+	}
+	if c.memoryMin == 0 {
+		// Keep memory per OCPU as the OCPUs step down.
+		c.memoryMin = c.memoryMax * c.ocpusMin / c.ocpusMax
+	}
+	if c.ocpusMin > c.ocpusMax || c.memoryMin > c.memoryMax {
+		e.failf("INSTANCE_OCPUS_MIN and INSTANCE_MEMORY_MIN must not exceed their maximum")
+	}
+
+	if c.provisionPollJitter < 0 || c.provisionPollJitter >= 1 {
+		e.failf("PROVISION_POLL_JITTER must be at least 0 and below 1")
+	}
+
+	if (c.maxRequestsPerDay > 0 || c.maxRequestsPerMonth > 0) && c.budgetFile == "" {
+		log.Printf("warn: REQUEST_BUDGET_FILE is not set, the request budget resets on restart")
+	}
+
+	if c.concurrency < 1 {
+		e.failf("CONCURRENCY must be at least 1")
+	}
+
+	for f := range c.features {
+		if !knownFeatures[f] {
+			e.failf("unknown FEATURES entry: %q", f)
+		}
+	}
+	c.adaptiveSchedule = c.adaptiveSchedule || c.features["adaptive-schedule"]
+
+	if c.errorsMax < 1 {
+		e.failf("ERRORS_MAX must be at least 1")
+	}
+
+	if c.backoffAfter < 1 {
+		e.failf("BACKOFF_AFTER_N_429 must be at least 1")
+	}
+
+	if c.minSuccessCount < 1 {
+		e.failf("MIN_SUCCESS_COUNT must be at least 1")
+	}
+
+	if c.skipIfExists && c.instanceName == "" {
+		e.failf("SKIP_IF_EXISTS requires INSTANCE_NAME")
+	}
+
+	if (c.telegramBotToken == "") != (c.telegramChatID == "") {
+		e.failf("TELEGRAM_BOT_TOKEN and TELEGRAM_CHAT_ID must be set together")
+	}
+
+	if c.onsTopicID != "" && !isOCID(c.onsTopicID, "onstopic") {
+		e.failf("invalid ONS_TOPIC_ID: %q", c.onsTopicID)
+	}
+
+	if c.coordinationFile != "" && c.coordinationURL != "" {
+		e.failf("COORDINATION_FILE and COORDINATION_URL are mutually exclusive")
+	}
+
+	if c.metricsExporter != "prometheus" && c.metricsExporter != "statsd" {
+		e.failf("invalid METRICS_EXPORTER: %q", c.metricsExporter)
+	}
+
+	if c.metricsTextfile != "" && c.metricsExporter != "prometheus" {
+		e.failf("METRICS_TEXTFILE requires METRICS_EXPORTER=prometheus")
+	}
+
+	if (c.metricsTLSCert == "") != (c.metricsTLSKey == "") {
+		e.failf("METRICS_TLS_CERT and METRICS_TLS_KEY must be set together")
+	}
+
+	if c.metricsBasicAuth != "" && !strings.Contains(c.metricsBasicAuth, ":") {
+		e.failf("METRICS_BASIC_AUTH must be in user:pass format")
+	}
+
+	return c, e.err()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+type coordinator interface {
+	claimed(ctx context.Context) (bool, error)
+	claim(ctx context.Context, instance core.Instance) error
+}
+
+// claims remembers the instances this process claimed, so that its own
+// claim is not taken for another hunter's.
+type claims struct {
+	mu  sync.Mutex
+	ids map[string]bool
+}
+
+type fileCoordinator struct {
+	path string
+	mine *claims
+}
+
+type httpCoordinator struct {
+	url  string
+	mine *claims
+}
+
+func newCoordinator(c config) coordinator {
+	mine := &claims{ids: map[string]bool{}}
+	switch {
+	case c.coordinationFile != "":
+		return fileCoordinator{path: c.coordinationFile, mine: mine}
+	case c.coordinationURL != "":
+		return httpCoordinator{url: c.coordinationURL, mine: mine}
+	}
+	return nil
+}
+
+func (c *claims) add(instance core.Instance) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ids[stringValue(instance.Id)] = true
+}
+
+// other reports whether a claim payload was written by someone else. A
+// marker that is not a claim payload always counts as someone else's.
+func (c *claims) other(b []byte) bool {
+	var p struct {
+		ID string `json:"id"`
+	}
+	if json.Unmarshal(b, &p) != nil || p.ID == "" {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.ids[p.ID]
+}
+
+func claimPayload(instance core.Instance) ([]byte, error) {
+	return json.Marshal(map[string]string{"id": stringValue(instance.Id), "shape": stringValue(instance.Shape)})
+}
+
+func (f fileCoordinator) claimed(context.Context) (bool, error) {
+	b, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return f.mine.other(b), nil
+}
+
+func (f fileCoordinator) claim(_ context.Context, instance core.Instance) error {
+	b, err := claimPayload(instance)
+	if err != nil {
+		return err
+	}
+	f.mine.add(instance)
+	return writeFileAtomic(f.path, b)
+}
+
+func (h httpCoordinator) claimed(ctx context.Context) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := notifyClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+		if err != nil {
+			return false, err
+		}
+		return h.mine.other(b), nil
+	case http.StatusNotFound, http.StatusNoContent:
+		return false, nil
+	}
+	return false, fmt.Errorf("coordination check: %s", resp.Status)
+}
+
+func (h httpCoordinator) claim(ctx context.Context, instance core.Instance) error {
+	b, err := claimPayload(instance)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	h.mine.add(instance)
+	resp, err := notifyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("coordination claim: %s", resp.Status)
+	}
+	return nil
+}
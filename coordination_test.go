@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+func TestCoordinatorIgnoresOwnClaim(t *testing.T) {
+	var mu sync.Mutex
+	var stored []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodPost:
+			stored, _ = io.ReadAll(r.Body)
+		case stored == nil:
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Write(stored)
+		}
+	}))
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "claim")
+
+	coordinators := map[string]struct {
+		c     coordinator
+		other func([]byte)
+	}{
+		"file": {newCoordinator(config{coordinationFile: path}), func(b []byte) {
+			if err := os.WriteFile(path, b, 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		"http": {newCoordinator(config{coordinationURL: srv.URL}), func(b []byte) {
+			mu.Lock()
+			defer mu.Unlock()
+			stored = b
+		}},
+	}
+	for name, tt := range coordinators {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			check := func(step string, want bool) {
+				t.Helper()
+				got, err := tt.c.claimed(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != want {
+					t.Errorf("%s: claimed = %v, want %v", step, got, want)
+				}
+			}
+
+			check("unclaimed", false)
+			if err := tt.c.claim(ctx, core.Instance{Id: common.String("ocid1.instance.oc1..mine")}); err != nil {
+				t.Fatal(err)
+			}
+			check("own claim", false)
+
+			other, err := claimPayload(core.Instance{Id: common.String("ocid1.instance.oc1..theirs")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.other(other)
+			check("other hunter's claim", true)
+
+			tt.other([]byte("claimed\n"))
+			check("plain marker", true)
+		})
+	}
+}
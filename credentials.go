@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/common/auth"
+)
+
+// credentialProvider builds the SDK configuration provider for one
+// AUTH_METHOD.
+type credentialProvider func(c config) (common.ConfigurationProvider, error)
+
+var credentialProviders = map[string]credentialProvider{
+	"raw":                rawCredentials,
+	"file":               fileCredentials,
+	"instance_principal": instancePrincipalCredentials,
+	"resource_principal": resourcePrincipalCredentials,
+	"session_token":      sessionTokenCredentials,
+}
+
+func rawCredentials(c config) (common.ConfigurationProvider, error) {
+	return common.NewRawConfigurationProvider(c.tenancy, c.user, c.region, c.fingerprint, c.privateKey, nil), nil
+}
+
+func fileCredentials(c config) (common.ConfigurationProvider, error) {
+	return common.ConfigurationProviderFromFileWithProfile(c.ociConfigFile, c.ociProfile, "")
+}
+
+func instancePrincipalCredentials(config) (common.ConfigurationProvider, error) {
+	return auth.InstancePrincipalConfigurationProvider()
+}
+
+func resourcePrincipalCredentials(config) (common.ConfigurationProvider, error) {
+	required := []string{auth.ResourcePrincipalVersionEnvVar}
+	switch os.Getenv(auth.ResourcePrincipalVersionEnvVar) {
+	case auth.ResourcePrincipalVersion2_2:
+		required = append(required, auth.ResourcePrincipalRPSTEnvVar, auth.ResourcePrincipalPrivatePEMEnvVar, auth.ResourcePrincipalRegionEnvVar)
+	case auth.ResourcePrincipalVersion1_1:
+		required = append(required, auth.ResourcePrincipalTokenEndpoint)
+	case "":
+	default:
+		return nil, fmt.Errorf("unsupported %s %q", auth.ResourcePrincipalVersionEnvVar, os.Getenv(auth.ResourcePrincipalVersionEnvVar))
+	}
+	var missing []string
+	for _, name := range required {
+		if os.Getenv(name) == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("not running with a resource principal, missing %s", strings.Join(missing, ", "))
+	}
+	return auth.ResourcePrincipalConfigurationProvider()
+}
+
+// sessionTokenCredentials reads a profile created by oci session
+// authenticate. The SDK rereads the token file on every request, so
+// refreshing it with oci session refresh outside goci keeps it working.
+func sessionTokenCredentials(c config) (common.ConfigurationProvider, error) {
+	cfg, err := common.ConfigurationProviderFromFileWithProfile(c.ociConfigFile, c.ociProfile, "")
+	if err != nil {
+		return nil, err
+	}
+	id, err := cfg.KeyID()
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(id, "ST$") {
+		return nil, fmt.Errorf("profile %s in %s has no security_token_file, run oci session authenticate", c.ociProfile, c.ociConfigFile)
+	}
+	return cfg, nil
+}
+
+// credentials returns the provider for c.authMethod and fills in the tenancy
+// and region when the method supplies them.
+func credentials(c *config) (common.ConfigurationProvider, error) {
+	p, ok := credentialProviders[c.authMethod]
+	if !ok {
+		return nil, fmt.Errorf("invalid AUTH_METHOD: %q", c.authMethod)
+	}
+	cfg, err := p(*c)
+	if err != nil {
+		return nil, fmt.Errorf("%s credentials: %w", c.authMethod, err)
+	}
+	if c.tenancy == "" {
+		if c.tenancy, err = cfg.TenancyOCID(); err != nil {
+			return nil, fmt.Errorf("%s credentials: %w", c.authMethod, err)
+		}
+	}
+	if c.region == "" {
+		r, err := cfg.Region()
+		if err != nil {
+			return nil, fmt.Errorf("%s credentials: %w", c.authMethod, err)
+		}
+		region, realm, err := normalizeRegion(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s credentials: %w", c.authMethod, err)
+		}
+		c.region, c.realm = string(region), realm
+	}
+	return cfg, nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oracle/oci-go-sdk/v65/common/auth"
+)
+
+const (
+	testTenancy     = "ocid1.tenancy.oc1..aaaatest"
+	testUser        = "ocid1.user.oc1..aaaatest"
+	testFingerprint = "aa:bb:cc:dd:ee:ff:00:11:22:33:44:55:66:77:88:99"
+)
+
+func testKey(t *testing.T) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+// testOCIConfig writes an OCI CLI config with a DEFAULT profile using an API
+// key and a SESSION profile created by oci session authenticate.
+func testOCIConfig(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	key := filepath.Join(dir, "key.pem")
+	token := filepath.Join(dir, "token")
+	if err := os.WriteFile(key, []byte(testKey(t)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(token, []byte("eyJhbGciOiJSUzI1NiJ9.e30.c2ln"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config")
+	body := fmt.Sprintf(`[DEFAULT]
+user=%[1]s
+fingerprint=%[2]s
+tenancy=%[3]s
+region=sa-saopaulo-1
+key_file=%[4]s
+
+[SESSION]
+fingerprint=%[2]s
+tenancy=%[3]s
+region=sa-vinhedo-1
+key_file=%[4]s
+security_token_file=%[5]s
+`, testUser, testFingerprint, testTenancy, key, token)
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCredentialProviders(t *testing.T) {
+	file := testOCIConfig(t)
+	tests := []struct {
+		name    string
+		c       config
+		region  string
+		keyID   string
+		wantErr string
+	}{
+		{
+			name:   "raw",
+			c:      config{authMethod: "raw", tenancy: testTenancy, user: testUser, region: "sa-saopaulo-1", realm: "oc1", fingerprint: testFingerprint, privateKey: testKey(t)},
+			region: "sa-saopaulo-1",
+			keyID:  testTenancy + "/" + testUser + "/" + testFingerprint,
+		},
+		{
+			name:   "file",
+			c:      config{authMethod: "file", ociConfigFile: file, ociProfile: "DEFAULT"},
+			region: "sa-saopaulo-1",
+			keyID:  testTenancy + "/" + testUser + "/" + testFingerprint,
+		},
+		{
+			name:   "session_token",
+			c:      config{authMethod: "session_token", ociConfigFile: file, ociProfile: "SESSION"},
+			region: "sa-vinhedo-1",
+			keyID:  "ST$eyJhbGciOiJSUzI1NiJ9.e30.c2ln",
+		},
+		{
+			name:    "session_token without token",
+			c:       config{authMethod: "session_token", ociConfigFile: file, ociProfile: "DEFAULT"},
+			wantErr: "run oci session authenticate",
+		},
+		{
+			name:    "file missing profile",
+			c:       config{authMethod: "file", ociConfigFile: file, ociProfile: "MISSING"},
+			wantErr: "file credentials",
+		},
+		{
+			name:    "resource_principal outside a function",
+			c:       config{authMethod: "resource_principal"},
+			wantErr: "missing " + auth.ResourcePrincipalVersionEnvVar,
+		},
+		{
+			name:    "unknown",
+			c:       config{authMethod: "kerberos"},
+			wantErr: "invalid AUTH_METHOD",
+		},
+	}
+	// instance_principal has no inputs; constructing it needs the instance
+	// metadata service, so it is only checked for being registered.
+	if _, ok := credentialProviders["instance_principal"]; !ok {
+		t.Error("instance_principal is not registered")
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(auth.ResourcePrincipalVersionEnvVar, "")
+			c := tt.c
+			cfg, err := credentials(&c)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.tenancy != testTenancy {
+				t.Errorf("tenancy = %q, want %q", c.tenancy, testTenancy)
+			}
+			if c.region != tt.region || c.realm != "oc1" {
+				t.Errorf("config region = %q in %q, want %q in oc1", c.region, c.realm, tt.region)
+			}
+			if region, err := cfg.Region(); err != nil || region != tt.region {
+				t.Errorf("region = %q (%v), want %q", region, err, tt.region)
+			}
+			if id, err := cfg.KeyID(); err != nil || id != tt.keyID {
+				t.Errorf("key id = %q (%v), want %q", id, err, tt.keyID)
+			}
+			if _, err := cfg.PrivateRSAKey(); err != nil {
+				t.Errorf("private key: %v", err)
+			}
+		})
+	}
+}
+
+func TestResourcePrincipalVersion(t *testing.T) {
+	t.Setenv(auth.ResourcePrincipalVersionEnvVar, "3.0")
+	if _, err := resourcePrincipalCredentials(config{}); err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Errorf("err = %v, want unsupported version", err)
+	}
+
+	t.Setenv(auth.ResourcePrincipalVersionEnvVar, auth.ResourcePrincipalVersion2_2)
+	t.Setenv(auth.ResourcePrincipalRPSTEnvVar, "")
+	_, err := resourcePrincipalCredentials(config{})
+	for _, name := range []string{auth.ResourcePrincipalRPSTEnvVar, auth.ResourcePrincipalPrivatePEMEnvVar, auth.ResourcePrincipalRegionEnvVar} {
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("err = %v, want it to name %s", err, name)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/identity"
+)
+
+func discover(ctx context.Context, c identity.IdentityClient) error {
+	tenancy, err := c.GetTenancy(ctx, identity.GetTenancyRequest{TenancyId: common.String(conf.tenancy)})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("root compartment: %s (%s)\n", *tenancy.Id, *tenancy.Name)
+
+	ads, err := c.ListAvailabilityDomains(ctx, identity.ListAvailabilityDomainsRequest{CompartmentId: common.String(conf.tenancy)})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("availability domains in %s:\n", conf.region)
+	for _, ad := range ads.Items {
+		fmt.Printf("  %s\n", *ad.Name)
+	}
+	return nil
+}
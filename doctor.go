@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/identity"
+)
+
+type check struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// doctor runs every check, logs a pass/fail line for each and returns the
+// exit code. Reaching it means the configuration already loaded.
+func doctor(ctx context.Context, cfg common.ConfigurationProvider, c core.ComputeClient, vn core.VirtualNetworkClient) int {
+	ic := newIdentityClient(cfg)
+	checks := []check{
+		{"config", func(context.Context) error { return nil }},
+		{"auth", func(ctx context.Context) error {
+			_, err := ic.ListAvailabilityDomains(ctx, identity.ListAvailabilityDomainsRequest{CompartmentId: common.String(conf.tenancy)})
+			return err
+		}},
+		{"subnet", func(ctx context.Context) error {
+			if conf.vnicHostname != "" {
+				return checkSubnetDNS(ctx, vn, conf.instanceSubnet, conf.vnicHostname)
+			}
+			_, err := vn.GetSubnet(ctx, core.GetSubnetRequest{SubnetId: common.String(conf.instanceSubnet)})
+			return err
+		}},
+		{"image", func(ctx context.Context) error {
+			var err error
+			switch {
+			case conf.instanceImage != "":
+				_, err = c.GetImage(ctx, core.GetImageRequest{ImageId: common.String(conf.instanceImage)})
+			case conf.instanceImageOS != "":
+				_, err = resolveImages(ctx, c, conf.instanceShapes)
+			case conf.instanceBootVolumeID != "":
+				bs, err := core.NewBlockstorageClientWithConfigurationProvider(cfg)
+				if err != nil {
+					return err
+				}
+				configureClient(&bs.BaseClient)
+				_, err = bs.GetBootVolume(ctx, core.GetBootVolumeRequest{BootVolumeId: common.String(conf.instanceBootVolumeID)})
+				return err
+			}
+			return err
+		}},
+		{"shape", func(ctx context.Context) error {
+			shapes, err := listShapes(ctx, c, conf.compartments.current())
+			if err != nil {
+				return err
+			}
+			return validateShapes(shapes)
+		}},
+		{"tags", func(ctx context.Context) error {
+			_, err := compartmentTags(ctx, ic, conf.instanceCompartments)
+			return err
+		}},
+		{"limits", func(ctx context.Context) error {
+			return checkLimits(ctx, cfg)
+		}},
+	}
+
+	failed := 0
+	for _, ch := range checks {
+		if err := ch.run(ctx); err != nil {
+			log.Printf("FAIL %s: %v", ch.name, err)
+			failed++
+			continue
+		}
+		log.Printf("PASS %s", ch.name)
+	}
+	if failed > 0 {
+		log.Printf("%d of %d checks failed", failed, len(checks))
+		return exitConfig
+	}
+	log.Printf("all %d checks passed", len(checks))
+	return exitSuccess
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var ocidPattern = regexp.MustCompile(`ocid1\.[a-z0-9]+\.[a-z0-9-]*\.[a-z0-9-]*\.[a-z0-9]+`)
+
+type errorEntry struct {
+	Message  string    `json:"message"`
+	Count    int       `json:"count"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+type errorLog struct {
+	mu      sync.Mutex
+	max     int
+	entries []*errorEntry
+}
+
+func newErrorLog(max int) *errorLog {
+	return &errorLog{max: max}
+}
+
+func (l *errorLog) add(message string) {
+	message = ocidPattern.ReplaceAllString(message, "<ocid>")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, e := range l.entries {
+		if e.Message == message {
+			e.Count++
+			e.LastSeen = time.Now()
+			l.entries = append(append(l.entries[:i], l.entries[i+1:]...), e)
+			return
+		}
+	}
+	l.entries = append(l.entries, &errorEntry{Message: message, Count: 1, LastSeen: time.Now()})
+	if len(l.entries) > l.max {
+		l.entries = l.entries[len(l.entries)-l.max:]
+	}
+}
+
+func (l *errorLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	entries := make([]errorEntry, len(l.entries))
+	for i, e := range l.entries {
+		entries[len(entries)-1-i] = *e
+	}
+	l.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+)
+
+const (
+	exitSuccess     = 0
+	exitFailure     = 1
+	exitAuth        = 2
+	exitQuota       = 3
+	exitMaxAttempts = 4
+	exitConfig      = 5
+)
+
+type LaunchError struct {
+	StatusCode  int    `json:"status_code,omitempty"`
+	Code        string `json:"code,omitempty"`
+	Message     string `json:"message"`
+	RequestID   string `json:"request_id,omitempty"`
+	AD          string `json:"ad,omitempty"`
+	Shape       string `json:"shape,omitempty"`
+	Compartment string `json:"compartment,omitempty"`
+	Err         error  `json:"-"`
+}
+
+func newLaunchError(err error, t target) error {
+	if err == nil {
+		return nil
+	}
+
+	le := &LaunchError{AD: t.AD, Shape: t.Shape, Compartment: t.Compartment, Message: err.Error(), Err: err}
+	if se, ok := common.IsServiceError(err); ok {
+		le.StatusCode = se.GetHTTPStatusCode()
+		le.Code = se.GetCode()
+		le.Message = se.GetMessage()
+		le.RequestID = se.GetOpcRequestID()
+	}
+	return le
+}
+
+func (e *LaunchError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("%s/%s: %s", e.AD, e.Shape, e.Message)
+	}
+	return fmt.Sprintf("%s/%s: %d %s: %s (request %s)", e.AD, e.Shape, e.StatusCode, e.Code, e.Message, e.RequestID)
+}
+
+func (e *LaunchError) Unwrap() error {
+	return e.Err
+}
+
+func misconfigured(status int, code string, message string) bool {
+	if (status != 400 || code != "InvalidParameter") && (status != 404 || code != "NotAuthorizedOrNotFound") {
+		return false
+	}
+	m := strings.ToLower(message)
+	return (strings.Contains(m, "shape") || strings.Contains(m, "image")) &&
+		(strings.Contains(m, "not found") || strings.Contains(m, "invalid") || strings.Contains(m, "does not exist"))
+}
+
+func (e *LaunchError) exitCode() int {
+	switch {
+	case e.StatusCode == 401:
+		return exitAuth
+	case misconfigured(e.StatusCode, e.Code, e.Message):
+		return exitConfig
+	case e.Code == "LimitExceeded" || e.Code == "QuotaExceeded":
+		return exitQuota
+	}
+	return exitFailure
+}
+
+func exitCode(err error) int {
+	if err == nil {
+		return exitSuccess
+	}
+	var le *LaunchError
+	if errors.As(err, &le) {
+		return le.exitCode()
+	}
+	var se common.ServiceError
+	if errors.As(err, &se) {
+		return (&LaunchError{StatusCode: se.GetHTTPStatusCode(), Code: se.GetCode(), Message: se.GetMessage()}).exitCode()
+	}
+	return exitFailure
+}
+
+func exit(code int, v ...interface{}) {
+	log.Print(v...)
+	os.Exit(code)
+}
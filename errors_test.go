@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestLaunchErrorExitCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		code    string
+		message string
+		want    int
+	}{
+		{"shape not found", 400, "InvalidParameter", "Shape VM.Standard.A9.Flex not found", exitConfig},
+		{"invalid shape", 400, "InvalidParameter", "Invalid shape: VM.Standard.E9", exitConfig},
+		{"image not found", 404, "NotAuthorizedOrNotFound", "Image ocid1.image.oc1..x does not exist", exitConfig},
+		{"invalid image", 400, "InvalidParameter", "Invalid image id", exitConfig},
+		{"other parameter", 400, "InvalidParameter", "Invalid ssh public key", exitFailure},
+		{"limit", 400, "LimitExceeded", "The following service limits were exceeded: standard-a1-core-count", exitQuota},
+		{"quota", 400, "QuotaExceeded", "Quota exceeded for shape", exitQuota},
+		{"shape wording on another code", 400, "CannotParseRequest", "shape not found", exitFailure},
+		{"not found without shape or image", 404, "NotAuthorizedOrNotFound", "Subnet does not exist", exitFailure},
+		{"capacity", 500, "InternalError", "Out of host capacity.", exitFailure},
+		{"auth", 401, "NotAuthenticated", "The required information to complete authentication was not provided", exitAuth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newLaunchError(serviceError{status: tt.status, code: tt.code, message: tt.message}, target{AD: "AD-1"})
+			if got := exitCode(err); got != tt.want {
+				t.Errorf("exitCode = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitCodeOtherErrors(t *testing.T) {
+	if got := exitCode(nil); got != exitSuccess {
+		t.Errorf("exitCode(nil) = %d, want %d", got, exitSuccess)
+	}
+	if got := exitCode(errors.New("dial tcp: i/o timeout")); got != exitFailure {
+		t.Errorf("exitCode(network) = %d, want %d", got, exitFailure)
+	}
+	auth := serviceError{status: 401, code: "NotAuthenticated", message: "The required information to complete authentication was not provided"}
+	if got := exitCode(fmt.Errorf("listing shapes: %w", auth)); got != exitAuth {
+		t.Errorf("exitCode(service 401) = %d, want %d", got, exitAuth)
+	}
+}
@@ -9,6 +9,7 @@ require (
 	go.opentelemetry.io/otel/exporters/prometheus v0.34.0
 	go.opentelemetry.io/otel/metric v0.34.0
 	go.opentelemetry.io/otel/sdk/metric v0.34.0
+	golang.org/x/time v0.3.0
 )
 
 require (
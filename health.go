@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/instrument/syncfloat64"
+)
+
+type health struct {
+	mu          sync.Mutex
+	window      time.Duration
+	lastSuccess time.Time
+	state       string
+	transitions syncfloat64.Counter
+}
+
+func newHealth(window time.Duration, transitions syncfloat64.Counter) *health {
+	return &health{window: window, transitions: transitions}
+}
+
+func (h *health) observe(success bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	if success {
+		h.lastSuccess = now
+	}
+
+	state := "degraded"
+	if !h.lastSuccess.IsZero() && now.Sub(h.lastSuccess) < h.window {
+		state = "healthy"
+	}
+
+	if h.state != "" && h.state != state {
+		log.Printf("health changed from %s to %s", h.state, state)
+		h.transitions.Add(context.TODO(), 1, attribute.Key("from").String(h.state), attribute.Key("to").String(state))
+	}
+	h.state = state
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+var imageKeywords = map[string][2]string{
+	"latest-oracle-linux-8": {"Oracle Linux", "8"},
+	"latest-oracle-linux-9": {"Oracle Linux", "9"},
+	"latest-ubuntu-20.04":   {"Canonical Ubuntu", "20.04"},
+	"latest-ubuntu-22.04":   {"Canonical Ubuntu", "22.04"},
+	"latest-ubuntu-24.04":   {"Canonical Ubuntu", "24.04"},
+}
+
+func resolveImages(ctx context.Context, c core.ComputeClient, shapes []string) (map[string]string, error) {
+	images := map[string]string{}
+	for _, shape := range shapes {
+		resp, err := c.ListImages(ctx, core.ListImagesRequest{
+			CompartmentId:          common.String(conf.compartments.current()),
+			OperatingSystem:        common.String(conf.instanceImageOS),
+			OperatingSystemVersion: optionalString(conf.instanceImageOSVersion),
+			Shape:                  common.String(shape),
+			SortBy:                 core.ListImagesSortByTimecreated,
+			SortOrder:              core.ListImagesSortOrderDesc,
+			LifecycleState:         core.ImageLifecycleStateAvailable,
+			Limit:                  common.Int(1),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Items) == 0 {
+			return nil, fmt.Errorf("no %s %s image compatible with %s", conf.instanceImageOS, conf.instanceImageOSVersion, shape)
+		}
+		images[shape] = *resp.Items[0].Id
+		log.Printf("using image %s (%s) for %s", *resp.Items[0].Id, stringValue(resp.Items[0].DisplayName), shape)
+	}
+	return images, nil
+}
+
+func imageFor(shape string) string {
+	if conf.instanceImage != "" {
+		return conf.instanceImage
+	}
+	return conf.images[shape]
+}
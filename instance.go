@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+var errProvisioningFailed = errors.New("instance provisioning failed")
+
+const consoleHistoryTimeout = 5 * time.Minute
+
+func waitForInstance(ctx context.Context, c core.ComputeClient, id string) (core.Instance, error) {
+	deadline := time.Now().Add(conf.provisionTimeout)
+	delay := conf.provisionPollInterval
+	for {
+		resp, err := c.GetInstance(ctx, core.GetInstanceRequest{InstanceId: common.String(id)})
+		if se, ok := common.IsServiceError(err); ok && (se.GetHTTPStatusCode() == 429 || se.GetHTTPStatusCode() >= 500) && time.Now().Add(delay).Before(deadline) {
+			log.Printf("warn: %s: %d polling instance, retrying in %v", id, se.GetHTTPStatusCode(), delay)
+			time.Sleep(jittered(delay, conf.provisionPollJitter))
+			if delay *= 2; delay > 5*time.Minute {
+				delay = 5 * time.Minute
+			}
+			continue
+		}
+		if err != nil {
+			return core.Instance{}, err
+		}
+		delay = conf.provisionPollInterval
+
+		// Any other state means provisioning went wrong. Returning as soon as
+		// it shows lets the console be captured before the instance is gone.
+		// A resize in update mode stops and starts the instance on its own.
+		switch resp.LifecycleState {
+		case core.InstanceLifecycleStateRunning:
+			return resp.Instance, nil
+		case core.InstanceLifecycleStateProvisioning, core.InstanceLifecycleStateStarting:
+		case core.InstanceLifecycleStateStopping, core.InstanceLifecycleStateStopped:
+			if conf.mode != "update" {
+				return resp.Instance, fmt.Errorf("%w: instance is %s", errProvisioningFailed, resp.LifecycleState)
+			}
+		default:
+			return resp.Instance, fmt.Errorf("%w: instance is %s", errProvisioningFailed, resp.LifecycleState)
+		}
+		if time.Now().After(deadline) {
+			return resp.Instance, fmt.Errorf("%w: still %s after %v", errProvisioningFailed, resp.LifecycleState, conf.provisionTimeout)
+		}
+
+		time.Sleep(jittered(conf.provisionPollInterval, conf.provisionPollJitter))
+	}
+}
+
+func terminateInstance(ctx context.Context, c core.ComputeClient, instance core.Instance) error {
+	if instance.LifecycleState == core.InstanceLifecycleStateTerminating || instance.LifecycleState == core.InstanceLifecycleStateTerminated {
+		return nil
+	}
+	_, err := c.TerminateInstance(ctx, core.TerminateInstanceRequest{
+		InstanceId:         instance.Id,
+		PreserveBootVolume: common.Bool(conf.preserveBootVolume),
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("%s: terminated, boot volume preserved: %v", *instance.Id, conf.preserveBootVolume)
+	return nil
+}
+
+func captureConsoleHistory(ctx context.Context, c core.ComputeClient, id string) error {
+	capture, err := c.CaptureConsoleHistory(ctx, core.CaptureConsoleHistoryRequest{
+		CaptureConsoleHistoryDetails: core.CaptureConsoleHistoryDetails{InstanceId: common.String(id)},
+	})
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(consoleHistoryTimeout)
+	for {
+		resp, err := c.GetConsoleHistory(ctx, core.GetConsoleHistoryRequest{InstanceConsoleHistoryId: capture.Id})
+		if err != nil {
+			return err
+		}
+		if resp.LifecycleState == core.ConsoleHistoryLifecycleStateSucceeded {
+			break
+		}
+		if resp.LifecycleState == core.ConsoleHistoryLifecycleStateFailed {
+			return errors.New("console history capture failed")
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("console history capture still %s after %v", resp.LifecycleState, consoleHistoryTimeout)
+		}
+		time.Sleep(5 * time.Second)
+	}
+
+	content, err := c.GetConsoleHistoryContent(ctx, core.GetConsoleHistoryContentRequest{
+		InstanceConsoleHistoryId: capture.Id,
+		Length:                   common.Int(1024 * 1024),
+	})
+	if err != nil {
+		return err
+	}
+
+	if conf.consoleHistoryFile != "" {
+		log.Printf("writing console history to %s", conf.consoleHistoryFile)
+		return os.WriteFile(conf.consoleHistoryFile, []byte(*content.Value), 0600)
+	}
+	log.Printf("console history of %s:\n%s", id, *content.Value)
+	return nil
+}
+
+func findRunningInstance(ctx context.Context, c core.ComputeClient, compartments []string, name string) (*core.Instance, error) {
+	for _, compartment := range compartments {
+		req := core.ListInstancesRequest{
+			CompartmentId:  common.String(compartment),
+			DisplayName:    common.String(name),
+			LifecycleState: core.InstanceLifecycleStateRunning,
+		}
+		for {
+			resp, err := c.ListInstances(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+			if len(resp.Items) > 0 {
+				return &resp.Items[0], nil
+			}
+			if resp.OpcNextPage == nil {
+				break
+			}
+			req.Page = resp.OpcNextPage
+		}
+	}
+	return nil, nil
+}
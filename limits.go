@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/limits"
+)
+
+var errAtLimit = errors.New("at service limit")
+
+var shapeLimits = map[string]string{
+	"VM.Standard.E2.1.Micro": "vm-standard-e2-1-micro-count",
+}
+
+// shapeLimitName returns the compute service limit that caps shape, as in
+// standard-a1-core-count for VM.Standard.A1.Flex.
+func shapeLimitName(shape string) string {
+	if name, ok := shapeLimits[shape]; ok {
+		return name
+	}
+	parts := strings.Split(strings.ToLower(shape), ".")
+	if len(parts) < 3 || parts[1] != "standard" {
+		return ""
+	}
+	return "standard-" + parts[2] + "-core-count"
+}
+
+// limitRequested returns how much of limit one launch takes: OCPUs for a
+// core-count limit, a single instance for a count limit.
+func limitRequested(limit string, ocpus float64) int64 {
+	if !strings.HasSuffix(limit, "-core-count") {
+		return 1
+	}
+	if n := int64(math.Ceil(ocpus)); n > 1 {
+		return n
+	}
+	return 1
+}
+
+func checkLimits(ctx context.Context, cfg common.ConfigurationProvider) error {
+	c, err := limits.NewLimitsClientWithConfigurationProvider(cfg)
+	if err != nil {
+		return err
+	}
+	configureClient(&c.BaseClient)
+
+	checked := map[string]bool{}
+	for _, t := range conf.targets.get() {
+		name := shapeLimitName(t.Shape)
+		if name == "" || checked[name+t.AD] {
+			continue
+		}
+		checked[name+t.AD] = true
+
+		defs, err := c.ListLimitDefinitions(ctx, limits.ListLimitDefinitionsRequest{
+			CompartmentId: common.String(conf.tenancy),
+			ServiceName:   common.String("compute"),
+			Name:          common.String(name),
+		})
+		if err != nil {
+			return err
+		}
+		if len(defs.Items) == 0 {
+			continue
+		}
+		req := limits.GetResourceAvailabilityRequest{
+			ServiceName:   common.String("compute"),
+			LimitName:     common.String(name),
+			CompartmentId: common.String(conf.tenancy),
+		}
+		if defs.Items[0].ScopeType == limits.LimitDefinitionSummaryScopeTypeAd {
+			req.AvailabilityDomain = optionalString(t.AD)
+		}
+		resp, err := c.GetResourceAvailability(ctx, req)
+		if err != nil {
+			return err
+		}
+		requested := limitRequested(name, conf.ocpusMin)
+		if resp.Available != nil && *resp.Available < requested {
+			return fmt.Errorf("%w: %s: %s has %d available and %d used, %d needed", errAtLimit, t.Shape, name, *resp.Available, valueOr(resp.Used), requested)
+		}
+	}
+	return nil
+}
+
+func valueOr(v *int64) int64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestLimitRequested(t *testing.T) {
+	tests := []struct {
+		shape string
+		ocpus float64
+		limit string
+		want  int64
+	}{
+		{"VM.Standard.E2.1.Micro", 1, "vm-standard-e2-1-micro-count", 1},
+		{"VM.Standard.E2.1.Micro", 4, "vm-standard-e2-1-micro-count", 1},
+		{"VM.Standard.A1.Flex", 4, "standard-a1-core-count", 4},
+		{"VM.Standard.A1.Flex", 1.5, "standard-a1-core-count", 2},
+		{"VM.Standard.A1.Flex", 0.5, "standard-a1-core-count", 1},
+		{"VM.Standard.E4.Flex", 2, "standard-e4-core-count", 2},
+		{"BM.DenseIO2.52", 52, "", 0},
+	}
+	for _, tt := range tests {
+		limit := shapeLimitName(tt.shape)
+		if limit != tt.limit {
+			t.Errorf("shapeLimitName(%s) = %q, want %q", tt.shape, limit, tt.limit)
+			continue
+		}
+		if limit == "" {
+			continue
+		}
+		if got := limitRequested(limit, tt.ocpus); got != tt.want {
+			t.Errorf("limitRequested(%s, %v) = %d, want %d", limit, tt.ocpus, got, tt.want)
+		}
+	}
+}
@@ -2,103 +2,559 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math/rand"
 	"net/http"
 	"os"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/oracle/oci-go-sdk/v65/common"
 	"github.com/oracle/oci-go-sdk/v65/core"
 
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"mol.net.br/goci/pkg/hunter"
 
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/metric/instrument"
-	"go.opentelemetry.io/otel/metric/instrument/asyncfloat64"
 	"go.opentelemetry.io/otel/metric/instrument/syncfloat64"
 	"go.opentelemetry.io/otel/sdk/metric"
 )
 
-type config struct {
-	instanceShape         string
-	instanceName          string
-	instanceImage         string
-	instanceSubnet        string
-	instanceAD            string
-	instanceCompartment   string
-	instanceSshAuthorized string
-	vnicDisplayName       string
-	vnicHostname          string
-	user                  string
-	fingerprint           string
-	privateKey            string
-	tenancy               string
-	region                string
-	counter               syncfloat64.Counter
-	gauge                 asyncfloat64.Gauge
-	messageRegex          *regexp.Regexp
-	delay                 time.Duration
-	lastDelayInc          time.Time
-}
+type target = hunter.Target
 
 var conf config
 
-func serveMetrics() {
-	log.Println("serving metrics at :2223/metrics")
-	http.Handle("/metrics", promhttp.Handler())
-	err := http.ListenAndServe(":2223", nil)
-	if err != nil {
-		log.Fatal(err)
+var version = "dev"
+
+var acquired *instances
+
+var sdkRetries atomic.Int64
+
+// sleep is replaced in tests so retries do not wait out their delay.
+var sleep = time.Sleep
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return common.String(s)
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func optionalInt64(i int) *int64 {
+	if i == 0 {
+		return nil
+	}
+	return common.Int64(int64(i))
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func optionalBool(b bool) *bool {
+	if !b {
+		return nil
+	}
+	return common.Bool(b)
+}
+
+func classify(response *http.Response) string {
+	if response == nil {
+		return classNetwork
+	}
+	return classifyStatus(response.StatusCode)
+}
+
+func classifyStatus(status int) string {
+	switch {
+	case status == 429:
+		return classRateLimit
+	case status == 503:
+		return classUnavailable
+	case status >= 500:
+		return classCapacity
+	default:
+		return classOther
 	}
 }
 
+// classifyError refines classify with the error body: a 429 whose body is
+// not a JSON service error comes from the edge rather than the service. The
+// service's own 429s also say "Too many requests", so only the body tells.
+func classifyError(response *http.Response, err error) string {
+	class := classify(response)
+	if se, ok := common.IsServiceError(err); ok && class == classRateLimit && se.GetCode() == "BadErrorResponse" {
+		return classEdgeRateLimit
+	}
+	return class
+}
+
 func shouldRetry(r common.OCIOperationResponse) bool {
-	response := r.Response.HTTPResponse()
+	if r.Error == nil {
+		return false
+	}
+
+	record(r)
+	if se, ok := common.IsServiceError(r.Error); ok && misconfigured(se.GetHTTPStatusCode(), se.GetCode(), se.GetMessage()) {
+		return false
+	}
+	sdkRetries.Add(1)
+	conf.sdkRetries.Add(context.TODO(), 1, attribute.Key("class").String(classifyError(httpResponse(r), r.Error)))
+	sleep(conf.limiter.retryDelay())
+	return true
+}
+
+// shouldRetryConsistent is used while the SDK is in its eventual consistency
+// window, after a resource was created or deleted in this process.
+func shouldRetryConsistent(r common.OCIOperationResponse) bool {
+	if !common.EventuallyConsistentShouldRetryOperation(r) {
+		return false
+	}
+	record(r)
+	conf.consistencyRetries.Add(context.TODO(), 1)
+	return true
+}
+
+func retryPolicyName() string {
+	if conf.eventualConsistency {
+		return "eventual_consistency"
+	}
+	return "default"
+}
+
+func newRetryPolicy() common.RetryPolicy {
+	return common.NewRetryPolicyWithOptions(
+		common.WithConditionalOption(true, common.ReplaceWithValuesFromRetryPolicy(common.DefaultRetryPolicyWithoutEventualConsistency())),
+		common.WithShouldRetryOperation(shouldRetry),
+		common.WithConditionalOption(conf.eventualConsistency, common.WithEventualConsistency()),
+		common.WithConditionalOption(conf.eventualConsistency, common.WithShouldRetryOperation(shouldRetryConsistent)),
+	)
+}
+
+func httpResponse(r common.OCIOperationResponse) *http.Response {
+	if r.Response == nil {
+		return nil
+	}
+	return r.Response.HTTPResponse()
+}
+
+func record(r common.OCIOperationResponse) {
+	response := httpResponse(r)
 
 	if response != nil {
+		size := conf.sizes.current()
 		attrs := []attribute.KeyValue{
 			attribute.Key("code").String(strconv.Itoa(response.StatusCode)),
+			attribute.Key("error_class").String(classifyError(response, r.Error)),
+			attribute.Key("compartment").String(conf.compartments.current()),
+			attribute.Key("ocpus").String(strconv.FormatFloat(float64(size.ocpus), 'g', -1, 32)),
+			attribute.Key("memory").String(strconv.FormatFloat(float64(size.memory), 'g', -1, 32)),
 		}
 
-		msg := conf.messageRegex.FindAllStringSubmatch(r.Error.Error(), 1)
-		for i := range msg {
-			attrs = append(attrs, attribute.Key("message").String(msg[i][1]))
+		for _, m := range conf.messageRegex.FindAllStringSubmatch(r.Error.Error(), 1) {
+			v := m[0]
+			if len(m) > 1 {
+				v = m[1]
+			}
+			attrs = append(attrs, attribute.Key("message").String(v))
 		}
 
-		conf.counter.Add(context.TODO(), 1, attrs...)
-
-		if response.StatusCode == 429 {
-			conf.delay += 1
+		if se, ok := common.IsServiceError(r.Error); ok {
+			conf.errors.add(se.GetCode() + ": " + se.GetMessage())
 		} else {
-			if time.Now().UTC().Sub(conf.lastDelayInc) > time.Duration(5*time.Minute) {
-				conf.delay -= 1
-				conf.lastDelayInc = time.Now().UTC()
-			}
+			conf.errors.add(r.Error.Error())
 		}
+
+		if se, ok := common.IsServiceError(r.Error); ok && conf.warnOnCodes[se.GetCode()] {
+			log.Printf("warn: %d %s: %s", response.StatusCode, se.GetCode(), se.GetMessage())
+			attrs = append(attrs, attribute.Key("warn").Bool(true))
+		}
+
+		conf.counter.Add(context.TODO(), 1, attrs...)
+		conf.rateLimits.update(response.Header)
 	} else {
+		conf.errors.add(r.Error.Error())
 		attrs := []attribute.KeyValue{
 			attribute.Key("message").String(r.Error.Error()),
+			attribute.Key("error_class").String(classNetwork),
 		}
 		conf.counter.Add(context.TODO(), 1, attrs...)
 	}
-	time.Sleep(conf.delay * time.Second)
-	return true
+
+	trigger, requestID := "network", ""
+	if response != nil {
+		trigger, requestID = strconv.Itoa(response.StatusCode), response.Header.Get("opc-request-id")
+	}
+
+	class := classifyError(response, r.Error)
+	if conf.limiter.adaptive != nil {
+		conf.limiter.adaptive.observe(class)
+	}
+	if conf.workers != nil {
+		conf.workers.observe(class)
+	}
+	change, from, to := conf.backoff.update(class)
+	switch change {
+	case 1:
+		conf.delayIncrements.Add(context.TODO(), 1, attribute.Key("class").String(class))
+		conf.audit.record(from, to, trigger, requestID)
+	case -1:
+		conf.delayDecrements.Add(context.TODO(), 1, attribute.Key("class").String(classRateLimit))
+		conf.audit.record(from, to, "decay", requestID)
+	}
+}
+
+func supportsNvmes(shape string) bool {
+	s := strings.ToLower(shape)
+	return strings.Contains(s, "denseio") || strings.Contains(s, "gpu")
+}
+
+func supportsLiveMigration(shape string) bool {
+	s := strings.ToLower(shape)
+	return !strings.HasPrefix(s, "bm.") && !strings.Contains(s, "denseio") && !strings.Contains(s, "gpu") && !strings.Contains(s, "hpc")
+}
+
+func liveMigrationPreferred(shape string) *bool {
+	if conf.liveMigrationPreferred != nil {
+		return conf.liveMigrationPreferred
+	}
+	return optionalBool(supportsLiveMigration(shape))
+}
+
+func shapeConfig(t target) *core.LaunchInstanceShapeConfigDetails {
+	size := conf.sizes.current()
+	sc := &core.LaunchInstanceShapeConfigDetails{Ocpus: common.Float32(size.ocpus), MemoryInGBs: common.Float32(size.memory)}
+	if conf.instanceNvmes > 0 && supportsNvmes(t.Shape) {
+		sc.Nvmes = common.Int(conf.instanceNvmes)
+	}
+	return sc
+}
+
+func platformConfig(c config, shape string) (core.LaunchInstancePlatformConfig, error) {
+	if !c.secureBoot && !c.measuredBoot && !c.tpmEnabled {
+		return nil, nil
+	}
+
+	secure, measured, tpm := common.Bool(c.secureBoot), common.Bool(c.measuredBoot), common.Bool(c.tpmEnabled)
+	switch {
+	case strings.HasPrefix(shape, "VM.Standard.E"):
+		return core.AmdVmLaunchInstancePlatformConfig{IsSecureBootEnabled: secure, IsMeasuredBootEnabled: measured, IsTrustedPlatformModuleEnabled: tpm}, nil
+	case strings.HasPrefix(shape, "VM.Standard2."), strings.HasPrefix(shape, "VM.Standard3."), strings.HasPrefix(shape, "VM.Optimized3."):
+		return core.IntelVmLaunchInstancePlatformConfig{IsSecureBootEnabled: secure, IsMeasuredBootEnabled: measured, IsTrustedPlatformModuleEnabled: tpm}, nil
+	case strings.HasPrefix(shape, "BM.Standard.E3."):
+		return core.AmdRomeBmLaunchInstancePlatformConfig{IsSecureBootEnabled: secure, IsMeasuredBootEnabled: measured, IsTrustedPlatformModuleEnabled: tpm}, nil
+	case strings.HasPrefix(shape, "BM.Standard.E4."):
+		return core.AmdMilanBmLaunchInstancePlatformConfig{IsSecureBootEnabled: secure, IsMeasuredBootEnabled: measured, IsTrustedPlatformModuleEnabled: tpm}, nil
+	case strings.HasPrefix(shape, "BM.Standard2."):
+		return core.IntelSkylakeBmLaunchInstancePlatformConfig{IsSecureBootEnabled: secure, IsMeasuredBootEnabled: measured, IsTrustedPlatformModuleEnabled: tpm}, nil
+	case strings.HasPrefix(shape, "BM.Standard3."), strings.HasPrefix(shape, "BM.Optimized3."):
+		return core.IntelIcelakeBmLaunchInstancePlatformConfig{IsSecureBootEnabled: secure, IsMeasuredBootEnabled: measured, IsTrustedPlatformModuleEnabled: tpm}, nil
+	}
+	return nil, fmt.Errorf("%s does not support shielded instances", shape)
+}
+
+func buildTargets(c config) []target {
+	ts := []target{}
+	if c.mode == "update" {
+		for _, shape := range c.instanceShapes {
+			ts = append(ts, target{Shape: shape})
+		}
+		return ts
+	}
+	if c.mode == "pool" {
+		for _, ad := range c.instanceADs {
+			ts = append(ts, target{AD: ad})
+		}
+		if len(ts) == 0 {
+			ts = append(ts, target{})
+		}
+		return ts
+	}
+	ads := c.instanceADs
+	if c.computeClusterID != "" && len(ads) > 1 {
+		ads = ads[:1]
+	}
+	for _, ad := range ads {
+		for _, shape := range c.instanceShapes {
+			ts = append(ts, target{AD: ad, Shape: shape})
+		}
+	}
+	return ts
+}
+
+func launchRequest(t target, retryPolicy *common.RetryPolicy) core.LaunchInstanceRequest {
+	if conf.launchDetails != nil {
+		d := *conf.launchDetails
+		d.AvailabilityDomain = common.String(t.AD)
+		d.Shape = common.String(t.Shape)
+		d.CompartmentId = common.String(t.Compartment)
+		return core.LaunchInstanceRequest{
+			LaunchInstanceDetails: d,
+			RequestMetadata:       common.RequestMetadata{RetryPolicy: retryPolicy},
+		}
+	}
+	pc, _ := platformConfig(conf, t.Shape)
+	return core.LaunchInstanceRequest{
+		LaunchInstanceDetails: core.LaunchInstanceDetails{
+			CompartmentId:      common.String(t.Compartment),
+			DisplayName:        common.String(conf.instanceName),
+			AvailabilityDomain: common.String(t.AD),
+			InstanceOptions:    &core.InstanceOptions{AreLegacyImdsEndpointsDisabled: common.Bool(false)},
+			LaunchOptions:      conf.launchOptions,
+			AvailabilityConfig: &core.LaunchInstanceAvailabilityConfigDetails{
+				IsLiveMigrationPreferred: liveMigrationPreferred(t.Shape),
+				RecoveryAction:           core.LaunchInstanceAvailabilityConfigDetailsRecoveryActionRestoreInstance,
+			},
+			CreateVnicDetails: &core.CreateVnicDetails{
+				AssignPublicIp:      common.Bool(true),
+				DisplayName:         common.String(conf.vnicDisplayName),
+				HostnameLabel:       common.String(conf.vnicHostname),
+				SubnetId:            common.String(conf.instanceSubnet),
+				PrivateIp:           optionalString(conf.instancePrivateIP),
+				SkipSourceDestCheck: common.Bool(conf.skipSourceDestCheck),
+			},
+			SourceDetails:                  sourceDetails(t.Shape),
+			IsPvEncryptionInTransitEnabled: optionalBool(conf.pvEncryption),
+			Shape:                          common.String(t.Shape),
+			ShapeConfig:                    shapeConfig(t),
+			PlatformConfig:                 pc,
+			Metadata:                       map[string]string{"ssh_authorized_keys": conf.instanceSshAuthorized},
+			DefinedTags:                    conf.definedTags[t.Compartment],
+		},
+		RequestMetadata: common.RequestMetadata{
+			RetryPolicy: retryPolicy,
+		},
+	}
+}
+
+func instanceConfigurationRequest(t target, retryPolicy *common.RetryPolicy) core.LaunchInstanceConfigurationRequest {
+	return core.LaunchInstanceConfigurationRequest{
+		InstanceConfigurationId: common.String(conf.instanceConfigurationID),
+		InstanceConfiguration: core.ComputeInstanceDetails{
+			LaunchDetails: &core.InstanceConfigurationLaunchInstanceDetails{
+				AvailabilityDomain: optionalString(t.AD),
+				CompartmentId:      optionalString(t.Compartment),
+			},
+		},
+		RequestMetadata: common.RequestMetadata{
+			RetryPolicy: retryPolicy,
+		},
+	}
+}
+
+func printRequest(t target) {
+	details := launchRequest(t, nil).LaunchInstanceDetails
+	metadata := map[string]string{}
+	for k := range details.Metadata {
+		metadata[k] = "[redacted]"
+	}
+	details.Metadata = metadata
+
+	b, err := json.MarshalIndent(details, "", "  ")
+	if err != nil {
+		log.Printf("warn: printing request: %v", err)
+		return
+	}
+	log.Printf("launch request:\n%s", b)
+}
+
+func updateRequest(t target, retryPolicy *common.RetryPolicy) core.UpdateInstanceRequest {
+	sc := shapeConfig(t)
+	return core.UpdateInstanceRequest{
+		InstanceId: common.String(conf.instanceID),
+		UpdateInstanceDetails: core.UpdateInstanceDetails{
+			Shape: common.String(t.Shape),
+			ShapeConfig: &core.UpdateInstanceShapeConfigDetails{
+				Ocpus:       sc.Ocpus,
+				MemoryInGBs: sc.MemoryInGBs,
+				Nvmes:       sc.Nvmes,
+			},
+		},
+		RequestMetadata: common.RequestMetadata{
+			RetryPolicy: retryPolicy,
+		},
+	}
+}
+
+func hunt(ctx context.Context, h *hunter.Hunter) []core.Instance {
+	results, err := h.Run(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		code := exitFailure
+		if acquired.count() > 0 {
+			code = exitSuccess
+		}
+		acquired.summarize()
+		exit(code, "RUN_DEADLINE reached")
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	instances := make([]core.Instance, len(results))
+	for i, r := range results {
+		instances[i] = r.Instance
+	}
+	return instances
+}
+
+func watchDeadline(ctx context.Context) {
+	deadline, _ := ctx.Deadline()
+	t := time.NewTicker(time.Hour)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			log.Printf("%v until RUN_DEADLINE", time.Until(deadline).Round(time.Minute))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func heartbeat(counter syncfloat64.Counter, started time.Time) {
+	t := time.NewTicker(conf.heartbeatInterval)
+	defer t.Stop()
+	for range t.C {
+		log.Printf("heartbeat: %d attempt(s), delay %v, last error %s, up %v", conf.hunter.Attempts(), conf.backoff.current(), conf.backoff.lastClass(), time.Since(started).Round(time.Second))
+		counter.Add(context.TODO(), 1)
+	}
+}
+
+func afterLaunch(c core.ComputeClient, instance core.Instance) error {
+	attach := conf.mode != "update" && len(conf.secondaryVnics) > 0
+	terminate := conf.mode != "update" && conf.terminateOnProvisionFailure
+	if !conf.captureConsole && !attach && !terminate {
+		return nil
+	}
+
+	inst, err := waitForInstance(context.TODO(), c, *instance.Id)
+	if errors.Is(err, errProvisioningFailed) && (conf.captureConsole || terminate) {
+		var result error
+		gone := inst.LifecycleState == core.InstanceLifecycleStateTerminating || inst.LifecycleState == core.InstanceLifecycleStateTerminated
+		if conf.captureConsole && gone {
+			log.Printf("%s: %v, console history is no longer available", *instance.Id, err)
+		} else if conf.captureConsole {
+			log.Printf("%s: %v, capturing console history", *instance.Id, err)
+			result = captureConsoleHistory(context.TODO(), c, *instance.Id)
+		}
+		if terminate {
+			log.Printf("%s: %v, terminating", *instance.Id, err)
+			if terr := terminateInstance(context.TODO(), c, inst); terr != nil {
+				result = terr
+			}
+		}
+		return result
+	}
+	if err != nil || !attach {
+		return err
+	}
+	return attachSecondaryVnics(context.TODO(), c, *instance.Id)
+}
+
+// handleAcquired records, announces and finishes setting up an instance
+// returned by the hunter.
+func handleAcquired(c core.ComputeClient, vn core.VirtualNetworkClient, instance core.Instance) error {
+	log.Printf("%s succeeded: %s in %s/%s", conf.mode, *instance.Id, stringValue(instance.AvailabilityDomain), stringValue(instance.FaultDomain))
+	acquired.add(instance)
+	if conf.coordinator != nil {
+		if err := conf.coordinator.claim(context.TODO(), instance); err != nil {
+			log.Printf("warn: %v", err)
+		}
+	}
+	conf.notifier.success(instance)
+
+	err := afterLaunch(c, instance)
+	if err == nil && conf.outputFile != "" {
+		err = writeOutput(context.TODO(), c, vn, instance)
+	}
+	return err
+}
+
+// handleBatch sets up the instances from one hunt, terminating those beyond
+// MIN_SUCCESS_COUNT when asked to. Only instances that were set up count
+// towards it; done reports that enough are kept to end the run, and err is
+// the last setup failure.
+func handleBatch(instances []core.Instance, setup, terminate func(core.Instance) error) (done bool, err error) {
+	for _, instance := range instances {
+		if conf.exitOnSuccess && conf.terminateExtraInstances && acquired.count() >= conf.minSuccessCount {
+			log.Printf("%s: beyond MIN_SUCCESS_COUNT, terminating", *instance.Id)
+			terr := terminate(instance)
+			if terr != nil {
+				log.Printf("warn: %s: %v", *instance.Id, terr)
+			}
+			acquired.terminate(instance, terr)
+			continue
+		}
+		if ierr := setup(instance); ierr != nil {
+			acquired.fail(instance, ierr)
+			if err != nil {
+				log.Println(err)
+			}
+			err = ierr
+		}
+	}
+	return conf.exitOnSuccess && acquired.count() >= conf.minSuccessCount, err
+}
+
+func newReader() (metric.Reader, error) {
+	if conf.metricsExporter == "statsd" {
+		exp, err := newStatsdExporter(conf.statsdAddr)
+		if err != nil {
+			return nil, err
+		}
+		return metric.NewPeriodicReader(exp, metric.WithInterval(10*time.Second)), nil
+	}
+	return prometheus.New()
 }
 
 func main() {
-	exporter, err := prometheus.New()
+	var err error
+	conf, err = loadConfig()
+	if err != nil {
+		exit(exitConfig, err)
+	}
+	cfg, err := credentials(&conf)
+	if err != nil {
+		exit(exitAuth, err)
+	}
+	log.Printf("using region %s in realm %s", conf.region, conf.realm)
+	if len(conf.features) > 0 {
+		log.Printf("enabled features: %s", strings.Join(sortedKeys(conf.features), ","))
+	}
+
+	var reader metric.Reader
+	for i := 0; ; i++ {
+		if reader, err = newReader(); err == nil || i == 2 {
+			break
+		}
+		d := time.Duration(1<<i)*time.Second + time.Duration(rand.Int63n(int64(time.Second)))
+		log.Printf("warn: metrics exporter: %v, retrying in %v", err, d.Round(time.Millisecond))
+		time.Sleep(d)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
-	provider := metric.NewMeterProvider(metric.WithReader(exporter))
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
 	meter := provider.Meter("goci")
 
-	go serveMetrics()
-
 	ctr, err := meter.SyncFloat64().Counter("oci_requests", instrument.WithDescription("Total number of HTTP requests by type."))
 	if err != nil {
 		log.Fatal(err)
@@ -108,75 +564,372 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	err = meter.RegisterCallback([]instrument.Asynchronous{gg}, func(ctx context.Context) {
-		gg.Observe(ctx, float64(conf.delay), []attribute.KeyValue{}...)
-	})
+	inc, err := meter.SyncFloat64().Counter("oci_delay_increments", instrument.WithDescription("Total number of delay increments."))
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	conf = config{
-		instanceShape:         os.Getenv("INSTANCE_SHAPE"),
-		instanceName:          os.Getenv("INSTANCE_NAME"),
-		instanceImage:         os.Getenv("INSTANCE_IMAGE"),
-		instanceSubnet:        os.Getenv("INSTANCE_SUBNET"),
-		instanceAD:            os.Getenv("INSTANCE_AD"),
-		instanceCompartment:   os.Getenv("INSTANCE_COMPARTMENT"),
-		instanceSshAuthorized: os.Getenv("INSTANCE_SSHAUTHORIZED"),
-		vnicDisplayName:       os.Getenv("VNIC_DISPLAY_NAME"),
-		vnicHostname:          os.Getenv("VNIC_HOSTNAME"),
-		user:                  os.Getenv("USER"),
-		fingerprint:           os.Getenv("FINGERPRINT"),
-		privateKey:            strings.Replace(os.Getenv("PRIVATE_KEY"), "\\n", "\n", -1),
-		tenancy:               os.Getenv("TENANCY"),
-		region:                os.Getenv("REGION"),
-		counter:               ctr,
-		gauge:                 gg,
-		messageRegex:          regexp.MustCompile(`Message: (.+)\.?`),
-		delay:                 31,
-		lastDelayInc:          time.Now().UTC(),
+	dec, err := meter.SyncFloat64().Counter("oci_delay_decrements", instrument.WithDescription("Total number of delay decrements."))
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	cfg := common.NewRawConfigurationProvider(conf.tenancy, conf.user, conf.region, conf.fingerprint, conf.privateKey, nil)
+	tr, err := meter.SyncFloat64().Counter("goci_health_transitions", instrument.WithDescription("Total number of transitions between healthy and degraded."))
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	c, err := core.NewComputeClientWithConfigurationProvider(cfg)
+	nt, err := meter.SyncFloat64().Counter("goci_notifications", instrument.WithDescription("Total number of notifications by channel and outcome."))
+	if err != nil {
+		log.Fatal(err)
+	}
+	ada, err := meter.SyncFloat64().Counter("oci_ad_attempts", instrument.WithDescription("Total number of launch attempts by availability domain."))
+	if err != nil {
+		log.Fatal(err)
+	}
+	ads, err := meter.SyncFloat64().Counter("oci_ad_success", instrument.WithDescription("Total number of successful launches by availability domain."))
+	if err != nil {
+		log.Fatal(err)
+	}
+	ec, err := meter.SyncFloat64().Counter("oci_eventual_consistency_retries", instrument.WithDescription("Total number of retries made by the eventual consistency retry policy."))
+	if err != nil {
+		log.Fatal(err)
+	}
+	hb, err := meter.SyncFloat64().Counter("goci_heartbeat", instrument.WithDescription("Total number of heartbeats emitted."))
+	if err != nil {
+		log.Fatal(err)
+	}
+	sr, err := meter.SyncFloat64().Counter("oci_sdk_retries", instrument.WithDescription("Total number of retries made by the SDK retry policy within launch attempts."))
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	retryPolicy := common.NewRetryPolicyWithOptions(
-		common.WithConditionalOption(true, common.ReplaceWithValuesFromRetryPolicy(common.DefaultRetryPolicyWithoutEventualConsistency())),
-		common.WithShouldRetryOperation(shouldRetry),
-	)
+	rl, err := meter.AsyncFloat64().Gauge("oci_ratelimit", instrument.WithDescription("Rate limit values reported by OCI response headers."))
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	request := core.LaunchInstanceRequest{
-		LaunchInstanceDetails: core.LaunchInstanceDetails{
-			CompartmentId:      common.String(conf.instanceCompartment),
-			DisplayName:        common.String(conf.instanceName),
-			AvailabilityDomain: common.String(conf.instanceAD),
-			InstanceOptions:    &core.InstanceOptions{AreLegacyImdsEndpointsDisabled: common.Bool(false)},
-			AvailabilityConfig: &core.LaunchInstanceAvailabilityConfigDetails{
-				IsLiveMigrationPreferred: common.Bool(true),
-				RecoveryAction:           core.LaunchInstanceAvailabilityConfigDetailsRecoveryActionRestoreInstance,
-			},
-			CreateVnicDetails: &core.CreateVnicDetails{
-				AssignPublicIp: common.Bool(true),
-				DisplayName:    common.String(conf.vnicDisplayName),
-				HostnameLabel:  common.String(conf.vnicHostname),
-				SubnetId:       common.String(conf.instanceSubnet),
-			},
-			SourceDetails: core.InstanceSourceViaImageDetails{ImageId: common.String(conf.instanceImage)},
-			Shape:         common.String(conf.instanceShape),
-			ShapeConfig:   &core.LaunchInstanceShapeConfigDetails{Ocpus: common.Float32(4), MemoryInGBs: common.Float32(24)},
-			Metadata:      map[string]string{"ssh_authorized_keys": conf.instanceSshAuthorized},
+	st, err := meter.AsyncFloat64().Gauge("goci_start_time_seconds", instrument.WithDescription("Start time of the process since unix epoch in seconds."))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ii, err := meter.AsyncFloat64().Gauge("goci_instance_info", instrument.WithDescription("Placement of instances obtained by this process."))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ci, err := meter.AsyncFloat64().Gauge("goci_config_info", instrument.WithDescription("Targets this process is hunting for."))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	na, err := meter.AsyncFloat64().Gauge("oci_next_attempt_timestamp_seconds", instrument.WithDescription("Time of the next scheduled attempt since unix epoch in seconds."))
+	if err != nil {
+		log.Fatal(err)
+	}
+	aw, err := meter.AsyncFloat64().Gauge("oci_active_workers", instrument.WithDescription("Number of workers currently allowed to attempt."))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	at, err := meter.AsyncFloat64().Counter("goci_attempts", instrument.WithDescription("Total number of launch attempts."))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	conf.counter = ctr
+	conf.sdkRetries = sr
+	conf.consistencyRetries = ec
+	conf.gauge = gg
+	conf.delayIncrements = inc
+	conf.delayDecrements = dec
+	conf.rateLimits = newRateLimits()
+	conf.backoff = newBackoff(conf.backoffAfter)
+	conf.limiter = newLimiter(conf.backoff, conf.targetRate, conf.warmupAttempts, conf.adaptiveSchedule)
+	conf.apiLimiter = newAPILimiter(conf.apiRateLimit)
+	conf.budget, err = newBudget(conf.maxRequestsPerDay, conf.maxRequestsPerMonth, conf.budgetFile)
+	if err != nil {
+		exit(exitConfig, err)
+	}
+	conf.health = newHealth(conf.healthWindow, tr)
+	conf.compartments = newRotation(conf.instanceCompartments)
+	conf.sizes = newSizes(conf.ocpusMin, conf.ocpusMax, conf.memoryMin, conf.memoryMax)
+	conf.targets = newTargetSet(buildTargets(conf))
+	conf.pause = newPause()
+	if conf.concurrency > 1 {
+		conf.workers = newWorkers(conf.concurrency)
+	}
+	conf.coordinator = newCoordinator(conf)
+	conf.errors = newErrorLog(conf.errorsMax)
+	conf.audit, err = newAudit(conf.delayAuditFile)
+	if err != nil {
+		exit(exitConfig, err)
+	}
+	acquired = newInstances()
+
+	// try is chosen by mode once the clients exist; the hunter is built now
+	// so that nothing started below ever sees it unset.
+	var try hunter.LauncherFunc
+	conf.hunter = hunter.New(hunter.Config{
+		Concurrency: conf.concurrency,
+		Active:      activeWorkers(),
+		Targets:     conf.targets.get,
+		Wait: func(ctx context.Context) error {
+			if err := conf.pause.wait(ctx); err != nil {
+				return err
+			}
+			if err := conf.limiter.wait(ctx); err != nil {
+				return err
+			}
+			if conf.coordinator != nil {
+				claimed, err := conf.coordinator.claimed(ctx)
+				if err != nil {
+					log.Printf("warn: %v", err)
+				} else if claimed {
+					exit(exitSuccess, "target already acquired by another hunter")
+				}
+			}
+			return nil
 		},
-		RequestMetadata: common.RequestMetadata{
-			RetryPolicy: &retryPolicy,
+		Done: func(t target, err error) {
+			conf.health.observe(err == nil)
+			ada.Add(context.TODO(), 1, attribute.Key("ad").String(t.AD))
+			if err == nil {
+				ads.Add(context.TODO(), 1, attribute.Key("ad").String(t.AD))
+			}
+			if err != nil {
+				go conf.notifier.failure(err)
+			}
+			if code := exitCode(err); code == exitAuth || code == exitConfig {
+				exit(code, err)
+			}
+			if err != nil && conf.maxAttempts > 0 && conf.hunter.Attempts() >= int64(conf.maxAttempts) {
+				exit(exitMaxAttempts, fmt.Sprintf("giving up after %d attempts: %v", conf.maxAttempts, err))
+			}
 		},
+	}, hunter.LauncherFunc(func(ctx context.Context, t target) (core.Instance, error) {
+		return try(ctx, t)
+	}))
+
+	started := time.Now()
+	g := gauges{delay: gg, rateLimit: rl, start: st, instances: ii, config: ci, nextAttempt: na, workers: aw, attempts: at}
+	for i := 0; ; i++ {
+		if err = meter.RegisterCallback(g.instruments(), g.callback(started)); err == nil || i == 2 {
+			break
+		}
+		log.Printf("warn: register metrics callback: %v, retrying", err)
+		time.Sleep(time.Duration(1<<i) * time.Second)
+	}
+	if err != nil {
+		if conf.metricsStrict {
+			log.Fatal(err)
+		}
+		log.Printf("warn: register metrics callback: %v, continuing without gauges", err)
+	}
+
+	if conf.instancePrivateIP != "" && conf.instanceSubnetCIDR == "" {
+		log.Printf("INSTANCE_SUBNET_CIDR not set, %s will be validated by OCI", conf.instancePrivateIP)
+	}
+
+	go serveMetrics()
+	if conf.metricsTextfile != "" {
+		go writeTextfile()
+	}
+	go watchReload()
+	if conf.heartbeatInterval > 0 {
+		go heartbeat(hb, started)
+	}
+
+	if conf.instanceNvmes > 0 {
+		for _, shape := range conf.instanceShapes {
+			if !supportsNvmes(shape) {
+				log.Printf("%s has no local NVMe, ignoring INSTANCE_NVMES", shape)
+			}
+		}
+	}
+
+	channels, err := notifyChannels(conf, cfg)
+	if err != nil {
+		exit(exitConfig, err)
+	}
+	conf.notifier = newNotifier(channels, conf.notifyOnError, conf.notifyMinInterval, nt)
+
+	if conf.discover {
+		if err := discover(context.TODO(), newIdentityClient(cfg)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	c, err := core.NewComputeClientWithConfigurationProvider(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	configureClient(&c.BaseClient)
+	if conf.computeClusterID != "" {
+		c.Interceptor = chainInterceptors(c.Interceptor, computeClusterInterceptor(conf.computeClusterID))
+	}
+
+	vn, err := core.NewVirtualNetworkClientWithConfigurationProvider(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	configureClient(&vn.BaseClient)
+
+	if conf.mode == "doctor" {
+		os.Exit(doctor(context.TODO(), cfg, c, vn))
+	}
+
+	if conf.validateSubnetDNS && conf.vnicHostname != "" && conf.buildsLaunchDetails() {
+		if err := checkSubnetDNS(context.TODO(), vn, conf.instanceSubnet, conf.vnicHostname); err != nil {
+			exit(exitConfig, err)
+		}
+	}
+
+	if conf.skipIfExists && conf.buildsLaunchDetails() {
+		instance, err := findRunningInstance(context.TODO(), c, conf.instanceCompartments, conf.instanceName)
+		if err != nil {
+			exit(exitCode(err), err)
+		}
+		if instance != nil {
+			exit(exitSuccess, fmt.Sprintf("%s: %s is already running, skipping launch", *instance.Id, conf.instanceName))
+		}
+	}
+
+	if conf.buildsLaunchDetails() {
+		shapes, err := listShapes(context.TODO(), c, conf.compartments.current())
+		switch {
+		case err != nil && conf.validateShape:
+			exit(exitCode(err), err)
+		case err != nil:
+			log.Printf("warn: listing shapes: %v", err)
+		default:
+			logBandwidth(shapes)
+			if conf.validateShape {
+				if err := validateShapes(shapes); err != nil {
+					exit(exitConfig, err)
+				}
+			}
+		}
+	}
+
+	if conf.checkLimits && conf.buildsLaunchDetails() {
+		switch err := checkLimits(context.TODO(), cfg); {
+		case errors.Is(err, errAtLimit) && conf.checkLimitsFatal:
+			exit(exitQuota, err)
+		case err != nil:
+			log.Printf("warn: service limits: %v", err)
+		}
+	}
+
+	if conf.instanceImageOS != "" && conf.buildsLaunchDetails() {
+		conf.images, err = resolveImages(context.TODO(), c, conf.instanceShapes)
+		if err != nil {
+			exit(exitConfig, err)
+		}
+	}
+
+	if conf.autoDefaultTags {
+		conf.definedTags, err = compartmentTags(context.TODO(), newIdentityClient(cfg), conf.instanceCompartments)
+		if err != nil {
+			exit(exitConfig, err)
+		}
+	}
+
+	retryPolicy := newRetryPolicy()
+
+	if conf.printRequest && conf.buildsLaunchDetails() {
+		t := conf.targets.get()[0]
+		t.Compartment = conf.compartments.current()
+		printRequest(t)
+	}
+
+	if conf.plan && conf.buildsLaunchDetails() {
+		if err := confirmPlan(); err != nil {
+			exit(exitConfig, err)
+		}
 	}
 
+	// Startup calls above only read; anything that changes resources goes
+	// below, after the plan is confirmed.
+	if conf.instanceBootVolumeID != "" && conf.buildsLaunchDetails() {
+		bs, err := core.NewBlockstorageClientWithConfigurationProvider(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		configureClient(&bs.BaseClient)
+		if err := prepareBootVolume(context.TODO(), bs); err != nil {
+			exit(exitConfig, err)
+		}
+	}
+
+	switch conf.mode {
+	case "launch":
+		try = func(ctx context.Context, t target) (core.Instance, error) {
+			t.Compartment = conf.compartments.current()
+			resp, err := c.LaunchInstance(ctx, launchRequest(t, &retryPolicy))
+			if se, ok := common.IsServiceError(err); ok && (se.GetCode() == "LimitExceeded" || se.GetCode() == "QuotaExceeded") {
+				conf.compartments.rotate(t.Compartment)
+			}
+			if se, ok := common.IsServiceError(err); ok && classifyStatus(se.GetHTTPStatusCode()) == classCapacity {
+				conf.sizes.stepDown()
+			}
+			return resp.Instance, newLaunchError(err, t)
+		}
+	case "update":
+		try = func(ctx context.Context, t target) (core.Instance, error) {
+			resp, err := c.UpdateInstance(ctx, updateRequest(t, &retryPolicy))
+			return resp.Instance, newLaunchError(err, t)
+		}
+	case "pool":
+		cm, err := core.NewComputeManagementClientWithConfigurationProvider(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		configureClient(&cm.BaseClient)
+		try = func(ctx context.Context, t target) (core.Instance, error) {
+			t.Compartment = conf.compartments.current()
+			resp, err := cm.LaunchInstanceConfiguration(ctx, instanceConfigurationRequest(t, &retryPolicy))
+			return resp.Instance, newLaunchError(err, t)
+		}
+	case "oneshot":
+		code := oneshot(c, conf.targets.get()[0])
+		if err := provider.Shutdown(context.TODO()); err != nil {
+			log.Println(err)
+		}
+		os.Exit(code)
+	}
+
+	ctx := context.Background()
+	if conf.runDeadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conf.runDeadline)
+		defer cancel()
+		go watchDeadline(ctx)
+	}
+
+	setup := func(instance core.Instance) error { return handleAcquired(c, vn, instance) }
+	terminate := func(instance core.Instance) error { return terminateInstance(context.TODO(), c, instance) }
 	for {
-		c.LaunchInstance(context.TODO(), request)
-		time.Sleep(conf.delay * time.Second)
+		done, err := handleBatch(hunt(ctx, conf.hunter), setup, terminate)
+		if done {
+			if err != nil {
+				log.Printf("warn: %v", err)
+			}
+			acquired.summarize()
+			return
+		}
+		// Too few are kept: rather than launch more that may fail the same
+		// way, stop here.
+		if err != nil && conf.exitOnSuccess {
+			log.Fatal(err)
+		}
+		if err != nil {
+			log.Println(err)
+		}
+		if conf.backoffResetOnSuccess && conf.backoff.reset() {
+			log.Printf("backoff reset to initial delays after success")
+		}
 	}
 }
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+
+	"mol.net.br/goci/pkg/hunter"
+
+	"go.opentelemetry.io/otel/metric/instrument/asyncfloat64"
+	"go.opentelemetry.io/otel/metric/instrument/syncfloat64"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+type serviceError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e serviceError) Error() string {
+	return fmt.Sprintf("Error returned by Compute Service. Http Status Code: %d. Error Code: %s. Opc request id: test. Message: %s", e.status, e.code, e.message)
+}
+
+func (e serviceError) GetHTTPStatusCode() int  { return e.status }
+func (e serviceError) GetMessage() string      { return e.message }
+func (e serviceError) GetCode() string         { return e.code }
+func (e serviceError) GetOpcRequestID() string { return "test" }
+
+func failure(status int, code, message string) common.OCIOperationResponse {
+	return common.OCIOperationResponse{
+		Response:      core.LaunchInstanceResponse{RawResponse: &http.Response{StatusCode: status, Header: http.Header{}}},
+		Error:         serviceError{status: status, code: code, message: message},
+		AttemptNumber: 1,
+	}
+}
+
+// testConf points conf at fresh state whose metrics go to the returned
+// reader, and makes retries return without sleeping.
+func testConf(t *testing.T) metric.Reader {
+	t.Helper()
+	reader := metric.NewManualReader()
+	meter := metric.NewMeterProvider(metric.WithReader(reader)).Meter("goci")
+	counter := func(name string) syncfloat64.Counter {
+		c, err := meter.SyncFloat64().Counter(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	saved, savedSleep, savedRetries := conf, sleep, sdkRetries.Load()
+	t.Cleanup(func() {
+		conf, sleep = saved, savedSleep
+		sdkRetries.Store(savedRetries)
+	})
+	sleep = func(time.Duration) {}
+	sdkRetries.Store(0)
+
+	conf = config{
+		messageRegex:       regexp.MustCompile(`Message: (.+)\.?`),
+		counter:            counter("oci_requests"),
+		sdkRetries:         counter("oci_sdk_retries"),
+		consistencyRetries: counter("oci_eventual_consistency_retries"),
+		delayIncrements:    counter("oci_delay_increments"),
+		delayDecrements:    counter("oci_delay_decrements"),
+		rateLimits:         newRateLimits(),
+		errors:             newErrorLog(10),
+		compartments:       newRotation([]string{"ocid1.compartment.oc1..test"}),
+		sizes:              newSizes(1, 1, 6, 6),
+		backoff:            newBackoff(1),
+	}
+	conf.limiter = newLimiter(conf.backoff, 0, 0, false)
+	return reader
+}
+
+// sum adds up every data point of the named counter.
+func sum(t *testing.T, reader metric.Reader, name string) float64 {
+	t.Helper()
+	rm, err := reader.Collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total float64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if s, ok := m.Data.(metricdata.Sum[float64]); ok && m.Name == name {
+				for _, dp := range s.DataPoints {
+					total += dp.Value
+				}
+			}
+		}
+	}
+	return total
+}
+
+func TestRetryPolicyWrapsShouldRetry(t *testing.T) {
+	tests := []struct {
+		name    string
+		failure common.OCIOperationResponse
+		retry   bool
+	}{
+		{"capacity", failure(500, "InternalError", "Out of host capacity."), true},
+		{"throttled", failure(429, "TooManyRequests", "Too many requests for the user."), true},
+		{"misconfigured", failure(400, "InvalidParameter", "Shape VM.Standard.A9 not found."), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := testConf(t)
+			policy := newRetryPolicy()
+
+			calls := 0
+			h := hunter.New(hunter.Config{
+				Targets: func() []target { return []target{{AD: "AD-1", Shape: "VM.Standard.A1.Flex"}} },
+			}, hunter.LauncherFunc(func(ctx context.Context, _ target) (core.Instance, error) {
+				calls++
+				if calls == 1 {
+					if got := policy.ShouldRetryOperation(tt.failure); got != tt.retry {
+						t.Errorf("ShouldRetryOperation = %v, want %v", got, tt.retry)
+					}
+					return core.Instance{}, tt.failure.Error
+				}
+				return core.Instance{Id: common.String("ocid1.instance.oc1..test")}, nil
+			}))
+			if _, err := h.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := sum(t, reader, "oci_requests"); got != 1 {
+				t.Errorf("oci_requests = %v, want 1", got)
+			}
+			want := 0.0
+			if tt.retry {
+				want = 1
+			}
+			if got := sum(t, reader, "oci_sdk_retries"); got != want {
+				t.Errorf("oci_sdk_retries = %v, want %v", got, want)
+			}
+			if got := sdkRetries.Load(); float64(got) != want {
+				t.Errorf("sdkRetries = %d, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyIgnoresSuccess(t *testing.T) {
+	reader := testConf(t)
+	if newRetryPolicy().ShouldRetryOperation(common.OCIOperationResponse{Response: core.LaunchInstanceResponse{}}) {
+		t.Error("ShouldRetryOperation retried a successful response")
+	}
+	if got := sum(t, reader, "oci_requests"); got != 0 {
+		t.Errorf("oci_requests = %v, want 0", got)
+	}
+}
+
+func TestShouldRetryConcurrentWithCallback(t *testing.T) {
+	testConf(t)
+	savedAcquired := acquired
+	t.Cleanup(func() { acquired = savedAcquired })
+
+	ts := []target{{AD: "AD-1", Shape: "VM.Standard.A1.Flex"}, {AD: "AD-2", Shape: "VM.Standard.A1.Flex"}}
+	conf.targets = newTargetSet(ts)
+	conf.workers = newWorkers(4)
+	conf.limiter = newLimiter(conf.backoff, 0, 0, true)
+	acquired = newInstances()
+	conf.hunter = hunter.New(hunter.Config{Targets: conf.targets.get}, hunter.LauncherFunc(func(context.Context, target) (core.Instance, error) {
+		return core.Instance{}, nil
+	}))
+
+	reader := metric.NewManualReader()
+	meter := metric.NewMeterProvider(metric.WithReader(reader)).Meter("goci")
+	gauge := func(name string) asyncfloat64.Gauge {
+		g, err := meter.AsyncFloat64().Gauge(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return g
+	}
+	at, err := meter.AsyncFloat64().Counter("goci_attempts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := gauges{
+		delay:       gauge("oci_requests_delay"),
+		rateLimit:   gauge("oci_ratelimit"),
+		start:       gauge("goci_start_time_seconds"),
+		instances:   gauge("goci_instance_info"),
+		config:      gauge("goci_config_info"),
+		nextAttempt: gauge("oci_next_attempt_timestamp_seconds"),
+		workers:     gauge("oci_active_workers"),
+		attempts:    at,
+	}
+	if err := meter.RegisterCallback(g.instruments(), g.callback(time.Now())); err != nil {
+		t.Fatal(err)
+	}
+
+	failures := []common.OCIOperationResponse{
+		failure(429, "TooManyRequests", "Too many requests for the user."),
+		failure(500, "InternalError", "Out of host capacity."),
+		failure(503, "ServiceUnavailable", "Service unavailable."),
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				shouldRetry(failures[(w+i)%len(failures)])
+			}
+		}(w)
+	}
+	for w := 0; w < 2; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if _, err := reader.Collect(context.Background()); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			acquired.add(core.Instance{Id: common.String(fmt.Sprintf("ocid1.instance.oc1..%d", i))})
+			conf.backoff.reset()
+		}
+	}()
+	wg.Wait()
+
+	if got := sdkRetries.Load(); got != 400 {
+		t.Errorf("sdkRetries = %d, want 400", got)
+	}
+}
+
+func TestClassifyStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{429, classRateLimit},
+		{500, classCapacity},
+		{502, classCapacity},
+		{503, classUnavailable},
+		{400, classOther},
+		{404, classOther},
+	}
+	for _, tt := range tests {
+		if got := classifyStatus(tt.status); got != tt.want {
+			t.Errorf("classifyStatus(%d) = %s, want %s", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestUnavailableBacksOffCapacityHolds(t *testing.T) {
+	tests := []struct {
+		status int
+		delays []time.Duration
+	}{
+		{500, []time.Duration{31 * time.Second, 31 * time.Second, 31 * time.Second}},
+		{503, []time.Duration{62 * time.Second, 124 * time.Second, 248 * time.Second}},
+	}
+	for _, tt := range tests {
+		b := newBackoff(1)
+		for i, want := range tt.delays {
+			b.update(classifyStatus(tt.status))
+			if got := b.current(); got != want {
+				t.Errorf("%d attempt %d: delay = %v, want %v", tt.status, i, got, want)
+			}
+		}
+	}
+}
+
+func TestRecordMessageRegex(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		want    string
+	}{
+		{"group", `Message: (.+)\.?`, "Out of host capacity."},
+		{"no group", `Out of \w+ capacity`, "Out of host capacity"},
+		{"empty group", `Message: ()`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := testConf(t)
+			conf.messageRegex = regexp.MustCompile(tt.pattern)
+			record(failure(500, "InternalError", "Out of host capacity."))
+
+			rm, err := reader.Collect(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					if s, ok := m.Data.(metricdata.Sum[float64]); ok && m.Name == "oci_requests" {
+						for _, dp := range s.DataPoints {
+							if v, ok := dp.Attributes.Value("message"); ok {
+								got = append(got, v.AsString())
+							}
+						}
+					}
+				}
+			}
+			if len(got) != 1 || got[0] != tt.want {
+				t.Errorf("message = %q, want [%q]", got, tt.want)
+			}
+		})
+	}
+}
+
+// edgeBody is what OCI's edge returns when it throttles before the request
+// reaches the service; the SDK fails to parse it as a service error.
+const edgeBody = `<html><head><title>429 Too Many Requests</title></head><body><center><h1>429 Too Many Requests</h1></center></body></html>`
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		resp common.OCIOperationResponse
+		want string
+	}{
+		{"edge 429", failure(429, "BadErrorResponse", "Failed to parse json from response body due to: invalid character '<' looking for beginning of value. With response body "+edgeBody+"."), classEdgeRateLimit},
+		{"service 429", failure(429, "TooManyRequests", "Too many requests for the user"), classRateLimit},
+		{"unparsable 500", failure(500, "BadErrorResponse", "Failed to parse json from response body due to: EOF."), classCapacity},
+		{"capacity", failure(500, "InternalError", "Out of host capacity."), classCapacity},
+		{"network", common.OCIOperationResponse{Error: errors.New("dial tcp: i/o timeout")}, classNetwork},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyError(httpResponse(tt.resp), tt.resp.Error); got != tt.want {
+				t.Errorf("classifyError = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleBatchCountsKeptInstances(t *testing.T) {
+	broken := errors.New("writing OUTPUT_FILE: permission denied")
+	tests := []struct {
+		name       string
+		min        int
+		terminate  bool
+		batches    [][]string
+		done       []bool
+		kept       int
+		terminated []string
+	}{
+		{"failed then ok", 1, true, [][]string{{"a-fail", "b"}}, []bool{true}, 1, nil},
+		{"ok then extra", 1, true, [][]string{{"a", "b"}}, []bool{true}, 1, []string{"b"}},
+		{"extras kept", 1, false, [][]string{{"a", "b"}}, []bool{true}, 2, nil},
+		{"failed batch does not count", 2, true, [][]string{{"a-fail"}, {"b"}, {"c", "d"}}, []bool{false, false, true}, 2, []string{"d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testConf(t)
+			savedAcquired := acquired
+			t.Cleanup(func() { acquired = savedAcquired })
+			acquired = newInstances()
+			conf.exitOnSuccess, conf.minSuccessCount, conf.terminateExtraInstances = true, tt.min, tt.terminate
+
+			var terminated []string
+			setup := func(instance core.Instance) error {
+				acquired.add(instance)
+				if *instance.Id == "a-fail" {
+					return broken
+				}
+				return nil
+			}
+			terminate := func(instance core.Instance) error {
+				terminated = append(terminated, *instance.Id)
+				return nil
+			}
+			for i, batch := range tt.batches {
+				var instances []core.Instance
+				for _, id := range batch {
+					instances = append(instances, core.Instance{Id: common.String(id)})
+				}
+				done, err := handleBatch(instances, setup, terminate)
+				if done != tt.done[i] {
+					t.Errorf("batch %d: done = %v, want %v", i, done, tt.done[i])
+				}
+				if (err != nil) != (batch[0] == "a-fail") {
+					t.Errorf("batch %d: err = %v", i, err)
+				}
+			}
+			if got := acquired.count(); got != tt.kept {
+				t.Errorf("kept %d instances, want %d", got, tt.kept)
+			}
+			if fmt.Sprint(terminated) != fmt.Sprint(tt.terminated) {
+				t.Errorf("terminated %v, want %v", terminated, tt.terminated)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/instrument/asyncfloat64"
+)
+
+type rateLimits struct {
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// gauges are the asynchronous instruments filled in by a single callback.
+type gauges struct {
+	delay, rateLimit, start, instances, config, nextAttempt, workers asyncfloat64.Gauge
+	attempts                                                         asyncfloat64.Counter
+}
+
+// acquisition is one instance the hunter returned and what became of it.
+type acquisition struct {
+	instance   core.Instance
+	err        error
+	terminated bool
+}
+
+type instances struct {
+	mu   sync.Mutex
+	list []*acquisition
+}
+
+func serveMetrics() {
+	log.Println("serving metrics at :2223/metrics")
+	http.Handle("/metrics", requireAuth(promhttp.Handler()))
+	http.Handle("/reload", requireAuth(http.HandlerFunc(reloadHandler)))
+	http.Handle("/pause", requireAuth(pauseHandler(true)))
+	http.Handle("/resume", requireAuth(pauseHandler(false)))
+	http.Handle("/status", requireAuth(http.HandlerFunc(statusHandler)))
+	http.Handle("/errors", requireAuth(conf.errors))
+
+	srv := &http.Server{
+		Addr:              ":2223",
+		ReadHeaderTimeout: conf.metricsReadHeaderTimeout,
+		ReadTimeout:       conf.metricsReadTimeout,
+		WriteTimeout:      conf.metricsWriteTimeout,
+		IdleTimeout:       conf.metricsIdleTimeout,
+	}
+
+	var err error
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			time.Sleep(5 * time.Second)
+		}
+		if conf.metricsTLSCert != "" {
+			err = srv.ListenAndServeTLS(conf.metricsTLSCert, conf.metricsTLSKey)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		log.Printf("warn: metrics server: %v", err)
+	}
+
+	if conf.metricsRequired {
+		log.Fatal(err)
+	}
+	log.Println("warn: metrics server disabled")
+}
+
+func writeTextfile() {
+	log.Printf("writing metrics to %s", conf.metricsTextfile)
+	for range time.Tick(conf.metricsTextfileInterval) {
+		if err := prometheus.WriteToTextfile(conf.metricsTextfile, prometheus.DefaultGatherer); err != nil {
+			log.Printf("warn: metrics textfile: %v", err)
+		}
+	}
+}
+
+func requireAuth(h http.Handler) http.Handler {
+	if conf.metricsAuthToken == "" && conf.metricsBasicAuth == "" {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conf.metricsAuthToken != "" && equal(r.Header.Get("Authorization"), "Bearer "+conf.metricsAuthToken) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if conf.metricsBasicAuth != "" {
+			if user, pass, ok := r.BasicAuth(); ok && equal(user+":"+pass, conf.metricsBasicAuth) {
+				h.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="goci"`)
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+func equal(a string, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func newRateLimits() *rateLimits {
+	return &rateLimits{values: map[string]float64{}}
+}
+
+func (r *rateLimits) update(header http.Header) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for k, v := range header {
+		name := strings.ToLower(k)
+		if !strings.HasPrefix(name, "x-ratelimit-") || len(v) == 0 {
+			continue
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(v[0]), 64)
+		if err != nil {
+			continue
+		}
+		r.values[strings.TrimPrefix(name, "x-ratelimit-")] = f
+	}
+}
+
+func (r *rateLimits) observe(ctx context.Context, gauge asyncfloat64.Gauge) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for k, v := range r.values {
+		gauge.Observe(ctx, v, attribute.Key("header").String(k))
+	}
+}
+
+func newInstances() *instances {
+	return &instances{}
+}
+
+func (i *instances) add(instance core.Instance) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.list = append(i.list, &acquisition{instance: instance})
+}
+
+func (i *instances) find(instance core.Instance) *acquisition {
+	for _, a := range i.list {
+		if stringValue(a.instance.Id) == stringValue(instance.Id) {
+			return a
+		}
+	}
+	a := &acquisition{instance: instance}
+	i.list = append(i.list, a)
+	return a
+}
+
+// fail records that setting up instance after launch failed.
+func (i *instances) fail(instance core.Instance, err error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.find(instance).err = err
+}
+
+// terminate records that instance was terminated, with err if that failed.
+func (i *instances) terminate(instance core.Instance, err error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	a := i.find(instance)
+	a.terminated = err == nil
+	if err != nil {
+		a.err = fmt.Errorf("terminating: %w", err)
+	}
+}
+
+// count returns the number of instances that were acquired and kept.
+func (i *instances) count() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.kept()
+}
+
+func (i *instances) kept() int {
+	n := 0
+	for _, a := range i.list {
+		if a.err == nil && !a.terminated {
+			n++
+		}
+	}
+	return n
+}
+
+func (a *acquisition) outcome() string {
+	switch {
+	case a.terminated:
+		return "terminated"
+	case a.err != nil:
+		return "failed: " + a.err.Error()
+	}
+	return "ok"
+}
+
+func (i *instances) summarize() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	log.Printf("acquired %d of %d launched instance(s) in %d attempt(s) and %d SDK retries", i.kept(), len(i.list), conf.hunter.Attempts(), sdkRetries.Load())
+	for _, a := range i.list {
+		inst := a.instance
+		log.Printf("  %s %s in %s/%s: %s", stringValue(inst.Id), stringValue(inst.Shape), stringValue(inst.AvailabilityDomain), stringValue(inst.FaultDomain), a.outcome())
+	}
+}
+
+func (i *instances) observe(ctx context.Context, gauge asyncfloat64.Gauge) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, a := range i.list {
+		if a.terminated {
+			continue
+		}
+		inst := a.instance
+		gauge.Observe(ctx, 1,
+			attribute.Key("id").String(stringValue(inst.Id)),
+			attribute.Key("ad").String(stringValue(inst.AvailabilityDomain)),
+			attribute.Key("fault_domain").String(stringValue(inst.FaultDomain)),
+			attribute.Key("shape").String(stringValue(inst.Shape)),
+		)
+	}
+}
+
+func (g gauges) instruments() []instrument.Asynchronous {
+	return []instrument.Asynchronous{g.delay, g.rateLimit, g.start, g.instances, g.config, g.nextAttempt, g.attempts, g.workers}
+}
+
+// callback observes every gauge. It reads conf from the metric reader's
+// goroutine, so it must only be registered once conf is fully built.
+func (g gauges) callback(started time.Time) func(context.Context) {
+	start := float64(started.UnixNano()) / float64(time.Second)
+	return func(ctx context.Context) {
+		conf.backoff.observe(ctx, g.delay)
+		conf.rateLimits.observe(ctx, g.rateLimit)
+		g.start.Observe(ctx, start)
+		acquired.observe(ctx, g.instances)
+		observeConfig(ctx, g.config)
+		conf.limiter.observe(ctx, g.nextAttempt)
+		g.attempts.Observe(ctx, float64(conf.hunter.Attempts()))
+		if conf.workers != nil {
+			conf.workers.observeGauge(ctx, g.workers)
+		}
+	}
+}
+
+func observeConfig(ctx context.Context, gauge asyncfloat64.Gauge) {
+	if conf.targets == nil {
+		return
+	}
+	for _, t := range conf.targets.get() {
+		sc := shapeConfig(t)
+		gauge.Observe(ctx, 1,
+			attribute.Key("shape").String(t.Shape),
+			attribute.Key("ad").String(t.AD),
+			attribute.Key("region").String(conf.region),
+			attribute.Key("compartment").String(conf.compartments.current()),
+			attribute.Key("ocpus").String(strconv.FormatFloat(float64(*sc.Ocpus), 'g', -1, 32)),
+			attribute.Key("memory").String(strconv.FormatFloat(float64(*sc.MemoryInGBs), 'g', -1, 32)),
+			attribute.Key("retry_policy").String(retryPolicyName()),
+		)
+	}
+}
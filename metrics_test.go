@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+func TestInstancesOutcomes(t *testing.T) {
+	i := newInstances()
+	instance := func(id string) core.Instance { return core.Instance{Id: common.String(id)} }
+	i.add(instance("ok"))
+	i.add(instance("failed"))
+	i.fail(instance("failed"), errors.New("provisioning failed"))
+	i.terminate(instance("extra"), nil)
+	i.terminate(instance("stuck"), errors.New("409 Conflict"))
+
+	want := map[string]string{
+		"ok":     "ok",
+		"failed": "failed: provisioning failed",
+		"extra":  "terminated",
+		"stuck":  "failed: terminating: 409 Conflict",
+	}
+	if len(i.list) != len(want) {
+		t.Fatalf("%d instances recorded, want %d", len(i.list), len(want))
+	}
+	for _, a := range i.list {
+		if got := a.outcome(); got != want[*a.instance.Id] {
+			t.Errorf("%s outcome = %q, want %q", *a.instance.Id, got, want[*a.instance.Id])
+		}
+	}
+	if got := i.count(); got != 1 {
+		t.Errorf("count = %d, want 1", got)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/ons"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/instrument/syncfloat64"
+)
+
+type channel interface {
+	name() string
+	post(text string) error
+}
+
+type webhook struct {
+	url string
+}
+
+type telegram struct {
+	token  string
+	chatID string
+}
+
+type topic struct {
+	client ons.NotificationDataPlaneClient
+	id     string
+}
+
+// outlet is a channel with its own failure notification interval.
+type outlet struct {
+	channel
+	lastError  time.Time
+	suppressed int
+}
+
+// delivery is one text for one outlet, covering failures failures.
+type delivery struct {
+	outlet   *outlet
+	text     string
+	failures int
+	failure  bool
+}
+
+type notifier struct {
+	outlets  []*outlet
+	counter  syncfloat64.Counter
+	onError  bool
+	interval time.Duration
+	mu       sync.Mutex
+}
+
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+func notifyChannels(c config, cfg common.ConfigurationProvider) ([]channel, error) {
+	var channels []channel
+	for _, url := range c.notifyWebhookURLs {
+		channels = append(channels, webhook{url: url})
+	}
+	if c.telegramBotToken != "" {
+		channels = append(channels, telegram{token: c.telegramBotToken, chatID: c.telegramChatID})
+	}
+	if c.onsTopicID != "" {
+		client, err := ons.NewNotificationDataPlaneClientWithConfigurationProvider(cfg)
+		if err != nil {
+			return nil, err
+		}
+		configureClient(&client.BaseClient)
+		channels = append(channels, topic{client: client, id: c.onsTopicID})
+	}
+	return channels, nil
+}
+
+func newNotifier(channels []channel, onError bool, interval time.Duration, counter syncfloat64.Counter) *notifier {
+	if len(channels) == 0 {
+		return nil
+	}
+	n := &notifier{onError: onError, interval: interval, counter: counter}
+	for _, c := range channels {
+		n.outlets = append(n.outlets, &outlet{channel: c})
+	}
+	return n
+}
+
+// success is sent to every channel right away, together with the count of
+// failures that channel has not been told about yet.
+func (n *notifier) success(instance core.Instance) {
+	if n == nil {
+		return
+	}
+	text := fmt.Sprintf("goci %s succeeded: %s (%s) in %s/%s", conf.mode, stringValue(instance.Id), stringValue(instance.Shape),
+		stringValue(instance.AvailabilityDomain), stringValue(instance.FaultDomain))
+
+	n.mu.Lock()
+	ds := make([]delivery, 0, len(n.outlets))
+	for _, o := range n.outlets {
+		d := delivery{outlet: o, text: text, failures: o.suppressed}
+		if o.suppressed > 0 {
+			d.text += fmt.Sprintf(" (after %d failures not notified)", o.suppressed)
+		}
+		o.suppressed = 0
+		ds = append(ds, d)
+	}
+	n.mu.Unlock()
+	n.send(ds)
+}
+
+// failure is sent to each channel at most once per interval; the failures
+// in between are counted and added to the next message on that channel.
+func (n *notifier) failure(err error) {
+	if n == nil || !n.onError {
+		return
+	}
+	text := fmt.Sprintf("goci %s failed: %v", conf.mode, err)
+
+	now := time.Now()
+	n.mu.Lock()
+	var ds []delivery
+	for _, o := range n.outlets {
+		if now.Sub(o.lastError) < n.interval {
+			o.suppressed++
+			continue
+		}
+		d := delivery{outlet: o, text: text, failures: o.suppressed + 1, failure: true}
+		if o.suppressed > 0 {
+			d.text += fmt.Sprintf(" (%d more failures since last notification)", o.suppressed)
+		}
+		o.lastError, o.suppressed = now, 0
+		ds = append(ds, d)
+	}
+	n.mu.Unlock()
+	if len(ds) > 0 {
+		n.send(ds)
+	}
+}
+
+// requeue puts the failures a delivery covered back on its outlet after the
+// post failed, so the next message on that channel still reports them.
+func (n *notifier) requeue(d delivery) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	d.outlet.suppressed += d.failures
+	if d.failure {
+		d.outlet.lastError = time.Time{}
+	}
+}
+
+// send posts every delivery concurrently. Each channel is counted on its
+// own, and the combined result is counted under channel "all" as sent,
+// partial or failed.
+func (n *notifier) send(ds []delivery) {
+	var wg sync.WaitGroup
+	var failed atomic.Int32
+	for _, d := range ds {
+		wg.Add(1)
+		go func(d delivery) {
+			defer wg.Done()
+			outcome := "sent"
+			if err := d.outlet.post(d.text); err != nil {
+				log.Printf("warn: notify %s: %v", d.outlet.name(), err)
+				outcome = "failed"
+				failed.Add(1)
+				n.requeue(d)
+			}
+			n.counter.Add(context.TODO(), 1, attribute.Key("channel").String(d.outlet.name()), attribute.Key("outcome").String(outcome))
+		}(d)
+	}
+	wg.Wait()
+
+	outcome := "sent"
+	switch f := int(failed.Load()); {
+	case f == len(ds):
+		outcome = "failed"
+	case f > 0:
+		outcome = "partial"
+	}
+	n.counter.Add(context.TODO(), 1, attribute.Key("channel").String("all"), attribute.Key("outcome").String(outcome))
+}
+
+func postJSON(url string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	resp, err := notifyClient.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+func (w webhook) name() string {
+	return "webhook"
+}
+
+func (w webhook) post(text string) error {
+	return postJSON(w.url, map[string]string{"text": text})
+}
+
+func (t telegram) name() string {
+	return "telegram"
+}
+
+func (t telegram) post(text string) error {
+	err := postJSON("https://api.telegram.org/bot"+t.token+"/sendMessage", map[string]string{"chat_id": t.chatID, "text": text})
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		// the URL carries the bot token
+		return ue.Err
+	}
+	return err
+}
+
+func (t topic) name() string {
+	return "ons"
+}
+
+func (t topic) post(text string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyClient.Timeout)
+	defer cancel()
+	_, err := t.client.PublishMessage(ctx, ons.PublishMessageRequest{
+		TopicId:        common.String(t.id),
+		MessageDetails: ons.MessageDetails{Title: common.String("goci " + conf.mode), Body: common.String(text)},
+	})
+	return err
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+
+	"go.opentelemetry.io/otel/sdk/metric"
+)
+
+type fakeChannel struct {
+	mu    sync.Mutex
+	id    string
+	down  bool
+	posts []string
+}
+
+func (f *fakeChannel) name() string { return f.id }
+
+func (f *fakeChannel) post(text string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		return errors.New("502 Bad Gateway")
+	}
+	f.posts = append(f.posts, text)
+	return nil
+}
+
+func TestNotifierIntervalPerChannel(t *testing.T) {
+	counter, err := metric.NewMeterProvider().Meter("goci").SyncFloat64().Counter("goci_notifications")
+	if err != nil {
+		t.Fatal(err)
+	}
+	up, flaky := &fakeChannel{id: "up"}, &fakeChannel{id: "flaky", down: true}
+	n := newNotifier([]channel{up, flaky}, true, time.Hour, counter)
+
+	n.failure(errors.New("Out of host capacity."))
+	flaky.down = false
+	n.failure(errors.New("Out of host capacity."))
+	n.failure(errors.New("Out of host capacity."))
+	n.success(core.Instance{Id: common.String("ocid1.instance.oc1..x")})
+
+	tests := []struct {
+		c    *fakeChannel
+		want []string
+	}{
+		// up took the first failure, so it held the next two back.
+		{up, []string{"failed: Out of host capacity.", "succeeded: ocid1.instance.oc1..x", "after 2 failures not notified"}},
+		// flaky missed the first failure, so its interval started on the second.
+		{flaky, []string{"failed: Out of host capacity. (1 more failures", "succeeded: ocid1.instance.oc1..x", "after 1 failures not notified"}},
+	}
+	for _, tt := range tests {
+		if len(tt.c.posts) != 2 {
+			t.Errorf("%s: got %d posts %q, want 2", tt.c.id, len(tt.c.posts), tt.c.posts)
+			continue
+		}
+		text := strings.Join(tt.c.posts, "\n")
+		for _, w := range tt.want {
+			if !strings.Contains(text, w) {
+				t.Errorf("%s: posts %q do not contain %q", tt.c.id, tt.c.posts, w)
+			}
+		}
+	}
+
+	n.success(core.Instance{Id: common.String("ocid1.instance.oc1..y")})
+	if last := up.posts[len(up.posts)-1]; strings.Contains(last, "not notified") {
+		t.Errorf("summary sent twice: %q", last)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+type result struct {
+	Success    bool         `json:"success"`
+	InstanceID string       `json:"instance_id,omitempty"`
+	AD         string       `json:"ad,omitempty"`
+	Shape      string       `json:"shape,omitempty"`
+	Error      *LaunchError `json:"error,omitempty"`
+}
+
+func oneshot(c core.ComputeClient, t target) int {
+	t.Compartment = conf.compartments.current()
+	noRetry := common.NoRetryPolicy()
+
+	resp, err := c.LaunchInstance(context.TODO(), launchRequest(t, &noRetry))
+	res := result{Success: err == nil, AD: t.AD, Shape: t.Shape}
+	if err == nil {
+		res.InstanceID = *resp.Id
+	} else {
+		record(common.NewOCIOperationResponse(resp, err, 1))
+		errors.As(newLaunchError(err, t), &res.Error)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(res)
+
+	if res.Error != nil {
+		return res.Error.exitCode()
+	}
+	return exitSuccess
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+type output struct {
+	ID                 string    `json:"id"`
+	DisplayName        string    `json:"display_name"`
+	Region             string    `json:"region"`
+	AvailabilityDomain string    `json:"availability_domain"`
+	FaultDomain        string    `json:"fault_domain"`
+	Shape              string    `json:"shape"`
+	PrivateIP          string    `json:"private_ip,omitempty"`
+	PublicIP           string    `json:"public_ip,omitempty"`
+	TimeCreated        time.Time `json:"time_created"`
+}
+
+func writeOutput(ctx context.Context, c core.ComputeClient, vn core.VirtualNetworkClient, instance core.Instance) error {
+	inst, err := waitForInstance(ctx, c, *instance.Id)
+	if err != nil {
+		return err
+	}
+
+	out := output{
+		ID:                 stringValue(inst.Id),
+		DisplayName:        stringValue(inst.DisplayName),
+		Region:             stringValue(inst.Region),
+		AvailabilityDomain: stringValue(inst.AvailabilityDomain),
+		FaultDomain:        stringValue(inst.FaultDomain),
+		Shape:              stringValue(inst.Shape),
+	}
+	if inst.TimeCreated != nil {
+		out.TimeCreated = inst.TimeCreated.Time
+	}
+
+	attachments, err := c.ListVnicAttachments(ctx, core.ListVnicAttachmentsRequest{
+		CompartmentId: inst.CompartmentId,
+		InstanceId:    inst.Id,
+	})
+	if err != nil {
+		return err
+	}
+	for _, a := range attachments.Items {
+		if a.VnicId == nil || a.LifecycleState != core.VnicAttachmentLifecycleStateAttached {
+			continue
+		}
+		vnic, err := vn.GetVnic(ctx, core.GetVnicRequest{VnicId: a.VnicId})
+		if err != nil {
+			return err
+		}
+		if vnic.IsPrimary != nil && *vnic.IsPrimary {
+			out.PrivateIP, out.PublicIP = stringValue(vnic.PrivateIp), stringValue(vnic.PublicIp)
+		}
+	}
+
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(conf.outputFile, b)
+}
+
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
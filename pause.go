@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+)
+
+type pause struct {
+	mu      sync.Mutex
+	resumed chan struct{}
+}
+
+func newPause() *pause {
+	return &pause{}
+}
+
+func (p *pause) paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.resumed != nil
+}
+
+func (p *pause) set(paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if paused == (p.resumed != nil) {
+		return
+	}
+	if paused {
+		p.resumed = make(chan struct{})
+		log.Println("paused")
+	} else {
+		close(p.resumed)
+		p.resumed = nil
+		log.Println("resumed")
+	}
+}
+
+func (p *pause) wait(ctx context.Context) error {
+	p.mu.Lock()
+	resumed := p.resumed
+	p.mu.Unlock()
+
+	if resumed == nil {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func pauseHandler(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		conf.pause.set(paused)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Mode   string `json:"mode"`
+		Paused bool   `json:"paused"`
+	}{conf.mode, conf.pause.paused()})
+}
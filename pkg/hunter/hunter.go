@@ -0,0 +1,166 @@
+// Package hunter implements the capacity-hunting loop behind goci: it keeps
+// launching across a set of targets until one attempt succeeds.
+package hunter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+// Target is a single placement to try.
+type Target struct {
+	AD          string
+	Shape       string
+	Compartment string
+}
+
+// Launcher makes one attempt at obtaining an instance for a target.
+type Launcher interface {
+	Launch(ctx context.Context, t Target) (core.Instance, error)
+}
+
+// LauncherFunc adapts a function to the Launcher interface.
+type LauncherFunc func(ctx context.Context, t Target) (core.Instance, error)
+
+// Launch calls f(ctx, t).
+func (f LauncherFunc) Launch(ctx context.Context, t Target) (core.Instance, error) {
+	return f(ctx, t)
+}
+
+// Config controls how a Hunter paces and spreads its attempts.
+type Config struct {
+	// Concurrency is the number of workers attempting in parallel.
+	Concurrency int
+	// Active, if set, returns how many of the Concurrency workers may attempt
+	// right now; workers above it idle until it grows again.
+	Active func() int
+	// Targets returns the current targets; it is called before every attempt
+	// so the set can change while running.
+	Targets func() []Target
+	// Wait, if set, blocks before every attempt.
+	Wait func(ctx context.Context) error
+	// Done, if set, is called after every successful attempt and every
+	// failed attempt that was not cancelled.
+	Done func(t Target, err error)
+}
+
+// Result describes a successful attempt.
+type Result struct {
+	Instance core.Instance
+	Target   Target
+}
+
+// Hunter runs attempts until one succeeds.
+type Hunter struct {
+	cfg      Config
+	launcher Launcher
+	attempts atomic.Int64
+}
+
+// ErrNoTargets is returned by Run when there is nothing to try.
+var ErrNoTargets = errors.New("hunter: no targets")
+
+// New returns a Hunter using launcher for every attempt.
+func New(cfg Config, launcher Launcher) *Hunter {
+	if cfg.Concurrency < 1 {
+		cfg.Concurrency = 1
+	}
+	return &Hunter{cfg: cfg, launcher: launcher}
+}
+
+// Attempts returns the number of attempts started over the Hunter's lifetime.
+func (h *Hunter) Attempts() int64 {
+	return h.attempts.Load()
+}
+
+// idle blocks while worker w is above the active count. It reports false
+// when ctx is done.
+func (h *Hunter) idle(ctx context.Context, w int) bool {
+	for h.cfg.Active != nil && w >= h.cfg.Active() {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(time.Second):
+		}
+	}
+	return true
+}
+
+// Run blocks until an attempt succeeds or ctx is done. Once an attempt
+// succeeds no new attempts start, but those already in flight are left to
+// finish, so with Concurrency above one several results may be returned.
+//
+// Cancelling ctx cancels in-flight attempts too. The service may still
+// create an instance for a request it had accepted before the cancellation;
+// such an instance is never returned and has to be found by listing.
+func (h *Hunter) Run(ctx context.Context) ([]Result, error) {
+	wait, stop := context.WithCancel(ctx)
+	defer stop()
+
+	var mu sync.Mutex
+	var results []Result
+	var failed error
+	var empty atomic.Bool
+	var wg sync.WaitGroup
+
+	for w := 0; w < h.cfg.Concurrency; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; ; i += h.cfg.Concurrency {
+				if !h.idle(wait, w) {
+					return
+				}
+				if h.cfg.Wait != nil {
+					if err := h.cfg.Wait(wait); err != nil {
+						mu.Lock()
+						if failed == nil {
+							failed = err
+						}
+						mu.Unlock()
+						return
+					}
+				}
+				if wait.Err() != nil {
+					return
+				}
+				ts := h.cfg.Targets()
+				if len(ts) == 0 {
+					empty.Store(true)
+					stop()
+					return
+				}
+				t := ts[i%len(ts)]
+				h.attempts.Add(1)
+				inst, err := h.launcher.Launch(ctx, t)
+				if (err == nil || ctx.Err() == nil) && h.cfg.Done != nil {
+					h.cfg.Done(t, err)
+				}
+				if err == nil {
+					mu.Lock()
+					results = append(results, Result{Instance: inst, Target: t})
+					mu.Unlock()
+					stop()
+					return
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	switch {
+	case len(results) > 0:
+		return results, nil
+	case empty.Load():
+		return nil, ErrNoTargets
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	default:
+		return nil, failed
+	}
+}
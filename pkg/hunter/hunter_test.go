@@ -0,0 +1,114 @@
+package hunter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+var targets = []Target{{AD: "AD-1", Shape: "VM.Standard.A1.Flex"}, {AD: "AD-2", Shape: "VM.Standard.A1.Flex"}}
+
+func TestRunReportsConcurrentSuccesses(t *testing.T) {
+	var started sync.WaitGroup
+	started.Add(2)
+	var done atomic.Int64
+	h := New(Config{
+		Concurrency: 2,
+		Targets:     func() []Target { return targets },
+		Done: func(t Target, err error) {
+			if err == nil {
+				done.Add(1)
+			}
+		},
+	}, LauncherFunc(func(ctx context.Context, t Target) (core.Instance, error) {
+		started.Done()
+		started.Wait()
+		if t.AD == "AD-2" {
+			// Finish after the other worker has already succeeded.
+			time.Sleep(50 * time.Millisecond)
+		}
+		if ctx.Err() != nil {
+			return core.Instance{}, ctx.Err()
+		}
+		return core.Instance{Id: common.String("ocid1.instance.oc1.." + t.AD)}, nil
+	}))
+
+	results, err := h.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if got := done.Load(); got != 2 {
+		t.Errorf("Done called for %d successes, want 2", got)
+	}
+	if got := h.Attempts(); got != 2 {
+		t.Errorf("Attempts = %d, want 2", got)
+	}
+}
+
+func TestRunStopsStartingAfterSuccess(t *testing.T) {
+	var calls atomic.Int64
+	h := New(Config{
+		Concurrency: 3,
+		Targets:     func() []Target { return targets },
+	}, LauncherFunc(func(ctx context.Context, t Target) (core.Instance, error) {
+		if calls.Add(1) == 5 {
+			return core.Instance{Id: common.String("ocid1.instance.oc1..x")}, nil
+		}
+		return core.Instance{}, errors.New("Out of host capacity.")
+	}))
+
+	results, err := h.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Errorf("got %d results, want 1", len(results))
+	}
+	if n := calls.Load(); n > 5+2 {
+		t.Errorf("%d attempts, want at most those in flight after the success", n)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	fail := LauncherFunc(func(context.Context, Target) (core.Instance, error) {
+		return core.Instance{}, errors.New("Out of host capacity.")
+	})
+	deadline, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	paused := errors.New("paused")
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		cfg  Config
+		want error
+	}{
+		{"no targets", context.Background(), Config{Targets: func() []Target { return nil }}, ErrNoTargets},
+		{"deadline", deadline, Config{Concurrency: 2, Targets: func() []Target { return targets }, Wait: func(ctx context.Context) error {
+			select {
+			case <-time.After(time.Millisecond):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}}, context.DeadlineExceeded},
+		{"wait", context.Background(), Config{Targets: func() []Target { return targets }, Wait: func(context.Context) error { return paused }}, paused},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := New(tt.cfg, fail).Run(tt.ctx)
+			if !errors.Is(err, tt.want) || results != nil {
+				t.Errorf("Run = %v, %v, want %v", results, err, tt.want)
+			}
+		})
+	}
+}
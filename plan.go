@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+func plan() string {
+	var b bytes.Buffer
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, t := range conf.targets.get() {
+		t.Compartment = conf.compartments.current()
+		d := launchRequest(t, nil).LaunchInstanceDetails
+		fmt.Fprintf(w, "+ instance %q\n", stringValue(d.DisplayName))
+		fmt.Fprintf(w, "  availability domain\t%s\n", stringValue(d.AvailabilityDomain))
+		fmt.Fprintf(w, "  shape\t%s\n", stringValue(d.Shape))
+		if sc := d.ShapeConfig; sc != nil && sc.Ocpus != nil && sc.MemoryInGBs != nil {
+			fmt.Fprintf(w, "  ocpus\t%v\n", *sc.Ocpus)
+			fmt.Fprintf(w, "  memory\t%v GB\n", *sc.MemoryInGBs)
+		}
+		switch s := d.SourceDetails.(type) {
+		case core.InstanceSourceViaImageDetails:
+			fmt.Fprintf(w, "  image\t%s\n", stringValue(s.ImageId))
+		case core.InstanceSourceViaBootVolumeDetails:
+			fmt.Fprintf(w, "  boot volume\t%s\n", stringValue(s.BootVolumeId))
+			if conf.bootVolumeSize > 0 {
+				fmt.Fprintf(w, "  boot volume size\t%d GB, grown before launch if smaller\n", conf.bootVolumeSize)
+			}
+		}
+		if v := d.CreateVnicDetails; v != nil {
+			fmt.Fprintf(w, "  subnet\t%s\n", stringValue(v.SubnetId))
+			fmt.Fprintf(w, "  public ip\t%v\n", v.AssignPublicIp != nil && *v.AssignPublicIp)
+		}
+		var tags []string
+		for ns, kv := range d.DefinedTags {
+			for k, v := range kv {
+				tags = append(tags, fmt.Sprintf("%s.%s=%v", ns, k, v))
+			}
+		}
+		for k, v := range d.FreeformTags {
+			tags = append(tags, k+"="+v)
+		}
+		sort.Strings(tags)
+		fmt.Fprintf(w, "  tags\t%s\n", strings.Join(tags, ", "))
+	}
+	w.Flush()
+	return b.String()
+}
+
+func confirmPlan() error {
+	log.Printf("plan:\n%s", plan())
+	if conf.confirm {
+		return nil
+	}
+	if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return errors.New("not attached to a terminal, set CONFIRM=true to launch")
+	}
+	fmt.Fprint(os.Stderr, "launch? [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+		return errors.New("launch not confirmed")
+	}
+	return nil
+}
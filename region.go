@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+)
+
+var knownRegions = []common.Region{
+	common.RegionAPChuncheon1,
+	common.RegionAPHyderabad1,
+	common.RegionAPMelbourne1,
+	common.RegionAPMumbai1,
+	common.RegionAPOsaka1,
+	common.RegionAPSeoul1,
+	common.RegionAPSydney1,
+	common.RegionAPTokyo1,
+	common.RegionCAMontreal1,
+	common.RegionCAToronto1,
+	common.RegionEUAmsterdam1,
+	common.RegionFRA,
+	common.RegionEUZurich1,
+	common.RegionMEJeddah1,
+	common.RegionMEDubai1,
+	common.RegionSASaopaulo1,
+	common.RegionUKCardiff1,
+	common.RegionLHR,
+	common.RegionIAD,
+	common.RegionPHX,
+	common.RegionSJC1,
+	common.RegionSAVinhedo1,
+	common.RegionSASantiago1,
+	common.RegionILJerusalem1,
+	common.RegionEUMarseille1,
+	common.RegionAPSingapore1,
+	common.RegionMEAbudhabi1,
+	common.RegionEUMilan1,
+	common.RegionEUStockholm1,
+	common.RegionAFJohannesburg1,
+	common.RegionEUParis1,
+	common.RegionMXQueretaro1,
+	common.RegionEUMadrid1,
+	common.RegionUSLangley1,
+	common.RegionUSLuke1,
+	common.RegionUSGovAshburn1,
+	common.RegionUSGovChicago1,
+	common.RegionUSGovPhoenix1,
+	common.RegionUKGovLondon1,
+	common.RegionUKGovCardiff1,
+	common.RegionAPChiyoda1,
+	common.RegionAPIbaraki1,
+	common.RegionMEDccMuscat1,
+	common.RegionAPDccCanberra1,
+	common.RegionEUDccMilan1,
+}
+
+func normalizeRegion(s string) (common.Region, string, error) {
+	region := common.StringToRegion(strings.TrimSpace(s))
+	realm, err := region.RealmID()
+	if err != nil {
+		names := make([]string, len(knownRegions))
+		for i, r := range knownRegions {
+			names[i] = string(r)
+		}
+		sort.Strings(names)
+		return "", "", fmt.Errorf("unknown REGION %q, valid regions are: %s", s, strings.Join(names, ", "))
+	}
+	return region, realm, nil
+}
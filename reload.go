@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+type targetSet struct {
+	mu sync.RWMutex
+	ts []target
+}
+
+var reloadMu sync.Mutex
+
+func newTargetSet(ts []target) *targetSet {
+	return &targetSet{ts: ts}
+}
+
+func (s *targetSet) get() []target {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ts
+}
+
+func (s *targetSet) set(ts []target) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ts = ts
+}
+
+func reload() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	c, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if c.mode != conf.mode {
+		return fmt.Errorf("MODE cannot be changed on reload")
+	}
+
+	if c.instanceImageOS != conf.instanceImageOS || c.instanceImageOSVersion != conf.instanceImageOSVersion {
+		return fmt.Errorf("INSTANCE_IMAGE_OS cannot be changed on reload")
+	}
+	if c.instanceImageOS != "" && c.buildsLaunchDetails() {
+		for _, shape := range c.instanceShapes {
+			if conf.images[shape] == "" {
+				return fmt.Errorf("no image resolved for %s, restart to add it", shape)
+			}
+		}
+	}
+
+	if conf.autoDefaultTags {
+		for _, comp := range c.instanceCompartments {
+			if _, ok := conf.definedTags[comp]; !ok {
+				return fmt.Errorf("no default tags resolved for compartment %s, restart to add it", comp)
+			}
+		}
+	}
+
+	old := conf.targets.get()
+	ts := buildTargets(c)
+	conf.targets.set(ts)
+	conf.compartments.set(c.instanceCompartments)
+	conf.limiter.setRate(c.targetRate)
+
+	log.Printf("reloaded targets %s -> %s", describeTargets(old), describeTargets(ts))
+	log.Printf("reloaded compartments %s, target rate %v/min", strings.Join(c.instanceCompartments, ","), c.targetRate)
+	return nil
+}
+
+func describeTargets(ts []target) string {
+	s := make([]string, len(ts))
+	for i, t := range ts {
+		s[i] = t.AD + "/" + t.Shape
+	}
+	return strings.Join(s, ",")
+}
+
+func watchReload() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	for range sigs {
+		if err := reload(); err != nil {
+			log.Printf("reload failed: %v", err)
+		}
+	}
+}
+
+func reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
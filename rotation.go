@@ -0,0 +1,54 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+)
+
+type rotation struct {
+	mu    sync.Mutex
+	items []string
+	i     int
+}
+
+func newRotation(items []string) *rotation {
+	return &rotation{items: items}
+}
+
+func (r *rotation) current() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.items) == 0 {
+		return ""
+	}
+	return r.items[r.i]
+}
+
+func (r *rotation) rotate(from string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.items) < 2 || r.items[r.i] != from {
+		return
+	}
+	r.i = (r.i + 1) % len(r.items)
+	log.Printf("switching from %s to %s", from, r.items[r.i])
+}
+
+func (r *rotation) set(items []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items = items
+	if r.i >= len(items) {
+		r.i = 0
+	}
+}
+
+func isOCID(s string, kinds ...string) bool {
+	for _, k := range kinds {
+		if strings.HasPrefix(s, "ocid1."+k+".") {
+			return true
+		}
+	}
+	return false
+}
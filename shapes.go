@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+func listShapes(ctx context.Context, c core.ComputeClient, compartment string) (map[string]core.Shape, error) {
+	shapes := map[string]core.Shape{}
+	req := core.ListShapesRequest{CompartmentId: common.String(compartment)}
+	for {
+		resp, err := c.ListShapes(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range resp.Items {
+			shapes[*s.Shape] = s
+		}
+		if resp.OpcNextPage == nil {
+			return shapes, nil
+		}
+		req.Page = resp.OpcNextPage
+	}
+}
+
+func expectedBandwidth(s core.Shape, ocpus float32) float32 {
+	o := s.NetworkingBandwidthOptions
+	if o == nil || o.DefaultPerOcpuInGbps == nil {
+		if s.NetworkingBandwidthInGbps == nil {
+			return 0
+		}
+		return *s.NetworkingBandwidthInGbps
+	}
+	bw := *o.DefaultPerOcpuInGbps * ocpus
+	if o.MinInGbps != nil && bw < *o.MinInGbps {
+		bw = *o.MinInGbps
+	}
+	if o.MaxInGbps != nil && bw > *o.MaxInGbps {
+		bw = *o.MaxInGbps
+	}
+	return bw
+}
+
+func logBandwidth(shapes map[string]core.Shape) {
+	for _, name := range conf.instanceShapes {
+		s, ok := shapes[name]
+		if !ok {
+			log.Printf("warn: %s is not available in compartment %s", name, conf.compartments.current())
+			continue
+		}
+		sc := shapeConfig(target{Shape: name})
+		log.Printf("%s with %v OCPUs and %v GB: expected network bandwidth %v Gbps", name, *sc.Ocpus, *sc.MemoryInGBs, expectedBandwidth(s, *sc.Ocpus))
+	}
+}
+
+func validateShape(s core.Shape, sc *core.LaunchInstanceShapeConfigDetails) error {
+	if s.IsFlexible == nil || !*s.IsFlexible {
+		return nil
+	}
+	ocpus, mem := *sc.Ocpus, *sc.MemoryInGBs
+
+	var errs []string
+	if o := s.OcpuOptions; o != nil && o.Min != nil && o.Max != nil && (ocpus < *o.Min || ocpus > *o.Max) {
+		errs = append(errs, fmt.Sprintf("%v OCPUs outside %v-%v", ocpus, *o.Min, *o.Max))
+	}
+	if m := s.MemoryOptions; m != nil {
+		if m.MinInGBs != nil && m.MaxInGBs != nil && (mem < *m.MinInGBs || mem > *m.MaxInGBs) {
+			errs = append(errs, fmt.Sprintf("%v GB outside %v-%v GB", mem, *m.MinInGBs, *m.MaxInGBs))
+		}
+		if m.MinPerOcpuInGBs != nil && m.MaxPerOcpuInGBs != nil && (mem/ocpus < *m.MinPerOcpuInGBs || mem/ocpus > *m.MaxPerOcpuInGBs) {
+			errs = append(errs, fmt.Sprintf("%v GB per OCPU outside %v-%v GB", mem/ocpus, *m.MinPerOcpuInGBs, *m.MaxPerOcpuInGBs))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s: %s", *s.Shape, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+func validateShapes(shapes map[string]core.Shape) error {
+	for _, name := range conf.instanceShapes {
+		s, ok := shapes[name]
+		if !ok {
+			return fmt.Errorf("%s is not available in compartment %s", name, conf.compartments.current())
+		}
+		if err := validateShape(s, shapeConfig(target{Shape: name})); err != nil {
+			return err
+		}
+	}
+	return nil
+}
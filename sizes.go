@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"sync"
+)
+
+type size struct {
+	ocpus  float32
+	memory float32
+}
+
+type sizes struct {
+	mu     sync.Mutex
+	levels []size
+	i      int
+}
+
+func newSizes(ocpusMin, ocpusMax, memoryMin, memoryMax float64) *sizes {
+	s := &sizes{}
+	for o := ocpusMax; o >= ocpusMin; o /= 2 {
+		s.levels = append(s.levels, sizeFor(o, ocpusMax, memoryMin, memoryMax))
+	}
+	if last := s.levels[len(s.levels)-1]; float64(last.ocpus) > ocpusMin {
+		s.levels = append(s.levels, sizeFor(ocpusMin, ocpusMax, memoryMin, memoryMax))
+	}
+	return s
+}
+
+func sizeFor(ocpus, ocpusMax, memoryMin, memoryMax float64) size {
+	memory := memoryMax * ocpus / ocpusMax
+	if memory < memoryMin {
+		memory = memoryMin
+	}
+	return size{ocpus: float32(ocpus), memory: float32(memory)}
+}
+
+func (s *sizes) current() size {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.levels[s.i]
+}
+
+// stepDown moves to the next smaller size, starting over from the largest
+// once the smallest has been tried.
+func (s *sizes) stepDown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.levels) == 1 {
+		return
+	}
+	from := s.levels[s.i]
+	s.i = (s.i + 1) % len(s.levels)
+	to := s.levels[s.i]
+	log.Printf("shape config changed from %v/%vGB to %v/%vGB", from.ocpus, from.memory, to.ocpus, to.memory)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewSizesLevels(t *testing.T) {
+	tests := []struct {
+		name                                     string
+		ocpusMin, ocpusMax, memoryMin, memoryMax float64
+		want                                     []size
+	}{
+		{"memory per OCPU", 1, 4, 6, 24, []size{{4, 24}, {2, 12}, {1, 6}}},
+		{"memory floor", 1, 4, 16, 24, []size{{4, 24}, {2, 16}, {1, 16}}},
+		{"min between halvings", 1.5, 4, 9, 24, []size{{4, 24}, {2, 12}, {1.5, 9}}},
+		{"single size", 4, 4, 24, 24, []size{{4, 24}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newSizes(tt.ocpusMin, tt.ocpusMax, tt.memoryMin, tt.memoryMax).levels
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("levels = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
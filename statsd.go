@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/aggregation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+type statsdExporter struct {
+	conn net.Conn
+}
+
+func newStatsdExporter(addr string) (*statsdExporter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdExporter{conn: conn}, nil
+}
+
+func (e *statsdExporter) Temporality(metric.InstrumentKind) metricdata.Temporality {
+	return metricdata.DeltaTemporality
+}
+
+func (e *statsdExporter) Aggregation(k metric.InstrumentKind) aggregation.Aggregation {
+	return metric.DefaultAggregationSelector(k)
+}
+
+func (e *statsdExporter) Export(ctx context.Context, rm metricdata.ResourceMetrics) error {
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[float64]:
+				for _, dp := range data.DataPoints {
+					if dp.Value != 0 {
+						e.send(m.Name, dp, "c")
+					}
+				}
+			case metricdata.Gauge[float64]:
+				for _, dp := range data.DataPoints {
+					e.send(m.Name, dp, "g")
+				}
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+func (e *statsdExporter) send(name string, dp metricdata.DataPoint[float64], kind string) {
+	line := fmt.Sprintf("%s:%g|%s", name, dp.Value, kind)
+	if dp.Attributes.Len() > 0 {
+		tags := make([]string, 0, dp.Attributes.Len())
+		for _, kv := range dp.Attributes.ToSlice() {
+			tags = append(tags, string(kv.Key)+":"+kv.Value.Emit())
+		}
+		line += "|#" + strings.Join(tags, ",")
+	}
+	e.conn.Write([]byte(line))
+}
+
+func (e *statsdExporter) ForceFlush(context.Context) error {
+	return nil
+}
+
+func (e *statsdExporter) Shutdown(context.Context) error {
+	return e.conn.Close()
+}
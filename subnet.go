@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+var hostnameLabel = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9-]{0,62}$`)
+
+func checkSubnetDNS(ctx context.Context, c core.VirtualNetworkClient, subnet string, hostname string) error {
+	if !hostnameLabel.MatchString(hostname) {
+		return fmt.Errorf("invalid VNIC_HOSTNAME: %q", hostname)
+	}
+
+	resp, err := c.GetSubnet(ctx, core.GetSubnetRequest{SubnetId: common.String(subnet)})
+	if err != nil {
+		return err
+	}
+	if resp.DnsLabel == nil {
+		return fmt.Errorf("subnet %s has DNS disabled, VNIC_HOSTNAME %s cannot be resolved", subnet, hostname)
+	}
+
+	vcn, err := c.GetVcn(ctx, core.GetVcnRequest{VcnId: resp.VcnId})
+	if err != nil {
+		return err
+	}
+	if vcn.DnsLabel == nil {
+		return fmt.Errorf("VCN %s has DNS disabled, VNIC_HOSTNAME %s cannot be resolved", *resp.VcnId, hostname)
+	}
+
+	log.Printf("instance will resolve as %s.%s", hostname, stringValue(resp.SubnetDomainName))
+	return nil
+}
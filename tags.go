@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/identity"
+)
+
+// defaultTags returns the required tag defaults that apply to compartment,
+// including those inherited from its parent compartments.
+func defaultTags(ctx context.Context, c identity.IdentityClient, compartment string) (map[string]map[string]interface{}, error) {
+	tags := map[string]map[string]interface{}{}
+	namespaces := map[string]string{}
+
+	resp, err := c.AssembleEffectiveTagSet(ctx, identity.AssembleEffectiveTagSetRequest{
+		CompartmentId:  common.String(compartment),
+		LifecycleState: identity.TagDefaultSummaryLifecycleStateActive,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, td := range resp.Items {
+		if td.IsRequired == nil || !*td.IsRequired {
+			continue
+		}
+
+		ns, ok := namespaces[*td.TagNamespaceId]
+		if !ok {
+			nsResp, err := c.GetTagNamespace(ctx, identity.GetTagNamespaceRequest{TagNamespaceId: td.TagNamespaceId})
+			if err != nil {
+				return nil, err
+			}
+			ns = *nsResp.Name
+			namespaces[*td.TagNamespaceId] = ns
+		}
+
+		if td.Value == nil || *td.Value == "" {
+			return nil, fmt.Errorf("required tag %s.%s has no default value", ns, *td.TagDefinitionName)
+		}
+		if tags[ns] == nil {
+			tags[ns] = map[string]interface{}{}
+		}
+		tags[ns][*td.TagDefinitionName] = *td.Value
+		log.Printf("using default tag %s.%s=%s in %s", ns, *td.TagDefinitionName, *td.Value, compartment)
+	}
+
+	return tags, nil
+}
+
+// compartmentTags resolves the default tags of every compartment once, so
+// each launch can use those of the compartment it targets.
+func compartmentTags(ctx context.Context, c identity.IdentityClient, compartments []string) (map[string]map[string]map[string]interface{}, error) {
+	tags := map[string]map[string]map[string]interface{}{}
+	for _, compartment := range compartments {
+		t, err := defaultTags(ctx, c, compartment)
+		if err != nil {
+			return nil, fmt.Errorf("compartment %s: %w", compartment, err)
+		}
+		tags[compartment] = t
+	}
+	return tags, nil
+}
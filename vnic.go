@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+const vnicAttachTimeout = 10 * time.Minute
+
+type secondaryVnic struct {
+	subnet string
+	nsgs   []string
+}
+
+func parseSecondaryVnics(s string) ([]secondaryVnic, error) {
+	vnics := []secondaryVnic{}
+	for _, entry := range parseList(s) {
+		parts := strings.Split(entry, "|")
+		v := secondaryVnic{subnet: strings.TrimSpace(parts[0])}
+		if !isOCID(v.subnet, "subnet") {
+			return nil, fmt.Errorf("invalid SECONDARY_VNIC_SUBNETS subnet: %q", v.subnet)
+		}
+		for _, nsg := range parts[1:] {
+			nsg = strings.TrimSpace(nsg)
+			if !isOCID(nsg, "networksecuritygroup") {
+				return nil, fmt.Errorf("invalid SECONDARY_VNIC_SUBNETS NSG: %q", nsg)
+			}
+			v.nsgs = append(v.nsgs, nsg)
+		}
+		vnics = append(vnics, v)
+	}
+	return vnics, nil
+}
+
+func attachSecondaryVnics(ctx context.Context, c core.ComputeClient, id string) error {
+	attached := []string{}
+	for _, v := range conf.secondaryVnics {
+		resp, err := c.AttachVnic(ctx, core.AttachVnicRequest{
+			AttachVnicDetails: core.AttachVnicDetails{
+				InstanceId: common.String(id),
+				CreateVnicDetails: &core.CreateVnicDetails{
+					SubnetId: common.String(v.subnet),
+					NsgIds:   v.nsgs,
+				},
+			},
+		})
+		if err == nil {
+			attached = append(attached, *resp.Id)
+			err = waitForVnicAttachment(ctx, c, *resp.Id)
+		}
+		if err != nil {
+			log.Printf("attaching VNIC in %s failed, detaching %d VNIC(s)", v.subnet, len(attached))
+			for _, a := range attached {
+				if _, derr := c.DetachVnic(ctx, core.DetachVnicRequest{VnicAttachmentId: common.String(a)}); derr != nil {
+					log.Printf("warn: detaching %s: %v", a, derr)
+				}
+			}
+			return err
+		}
+		log.Printf("attached VNIC in %s: %s", v.subnet, *resp.Id)
+	}
+	return nil
+}
+
+func waitForVnicAttachment(ctx context.Context, c core.ComputeClient, id string) error {
+	deadline := time.Now().Add(vnicAttachTimeout)
+	for {
+		resp, err := c.GetVnicAttachment(ctx, core.GetVnicAttachmentRequest{VnicAttachmentId: common.String(id)})
+		if err != nil {
+			return err
+		}
+
+		switch resp.LifecycleState {
+		case core.VnicAttachmentLifecycleStateAttached:
+			return nil
+		case core.VnicAttachmentLifecycleStateDetaching, core.VnicAttachmentLifecycleStateDetached:
+			return errors.New("VNIC attachment " + id + " was detached")
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("VNIC attachment %s still %s after %v", id, resp.LifecycleState, vnicAttachTimeout)
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"go.opentelemetry.io/otel/metric/instrument/asyncfloat64"
+)
+
+type workers struct {
+	mu     sync.Mutex
+	max    int
+	active int
+	clean  int
+}
+
+func newWorkers(max int) *workers {
+	return &workers{max: max, active: max}
+}
+
+func (w *workers) observe(class string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	from := w.active
+	if class == classRateLimit || class == classEdgeRateLimit {
+		w.clean = 0
+		if w.active /= 2; w.active < 1 {
+			w.active = 1
+		}
+	} else if w.clean++; w.clean >= w.active && w.active < w.max {
+		w.clean = 0
+		w.active++
+	}
+	if w.active != from {
+		log.Printf("active workers changed from %d to %d", from, w.active)
+	}
+}
+
+func (w *workers) get() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.active
+}
+
+func (w *workers) observeGauge(ctx context.Context, gauge asyncfloat64.Gauge) {
+	gauge.Observe(ctx, float64(w.get()))
+}
+
+func activeWorkers() func() int {
+	if conf.workers == nil {
+		return nil
+	}
+	return conf.workers.get
+}